@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var testDiffs = []struct {
+	a, b string
+	want string
+}{
+	{a: "same\n", b: "same\n", want: ""},
+	{
+		a:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+		b:    "1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\n",
+		want: "--- a\n+++ b\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+	},
+	{
+		a:    "",
+		b:    "new\n",
+		want: "--- a\n+++ b\n@@ -0,0 +1,1 @@\n+new\n",
+	},
+	{
+		a: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n",
+		b: "x\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n",
+		want: "--- a\n+++ b\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n" +
+			"@@ -13,4 +13,3 @@\n 13\n 14\n 15\n-16\n",
+	},
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	for _, tc := range testDiffs {
+		if got := unifiedDiff("a", "b", tc.a, tc.b); got != tc.want {
+			t.Errorf("got:\n%s\nwanted:\n%s", got, tc.want)
+		}
+	}
+}
+
+func TestCheckFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"jsonschema-pb-cr.yaml": "kind: Jsonschema\n"}
+	if checkFiles(files, dir) {
+		t.Error("missing file reported as up to date")
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "jsonschema-pb-cr.yaml"), []byte("kind: Other\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if checkFiles(files, dir) {
+		t.Error("changed file reported as up to date")
+	}
+	writeFiles(files, dir)
+	if !checkFiles(files, dir) {
+		t.Error("written file reported as out of date")
+	}
+
+	// Hand-kept files are not reported, but stale CR files are.
+	if err := ioutil.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte("resources: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !checkFiles(files, dir) {
+		t.Error("file that is not a CR reported as extra")
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "jsonschema-removed-cr.yaml"), []byte("kind: Jsonschema\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if checkFiles(files, dir) {
+		t.Error("stale CR file reported as up to date")
+	}
+}
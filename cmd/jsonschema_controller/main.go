@@ -0,0 +1,60 @@
+// Command jsonschema_controller registers the schemas of the Jsonschema
+// resources in a Kubernetes cluster with a Schema Registry, as described
+// in the jsonschema_controller package.
+//
+// The registry is taken from SCHEMA_REGISTRY_URL, with credentials from
+// SCHEMA_REGISTRY_USERNAME and SCHEMA_REGISTRY_PASSWORD and an optional
+// context from SCHEMA_REGISTRY_CONTEXT. Inside a cluster the pod's
+// service account is used; -apiserver points it at another API server,
+// such as kubectl proxy, instead. The subjects of deleted Jsonschemas are
+// kept unless -deletesubjects is given. Statuses are only reported if the
+// CRD was generated with the status option.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/infobloxopen/schema-registry-helper/internal/cmdutil"
+	"github.com/infobloxopen/schema-registry-helper/jsonschema_controller"
+)
+
+func main() {
+	registryURL := flag.String("url", cmdutil.RegistryURL(), "schema registry URL")
+	schemaContext := flag.String("context", cmdutil.RegistryContext(), "schema registry context")
+	group := flag.String("group", "schemaregistry.infoblox.com", "API group of the Jsonschema CRD")
+	version := flag.String("version", "v1", "API version of the Jsonschema CRD")
+	apiServer := flag.String("apiserver", "", "Kubernetes API server URL, e.g. http://localhost:8001 for kubectl proxy; the in-cluster service account if empty")
+	token := flag.String("token", "", "bearer token for -apiserver")
+	deleteSubjects := flag.Bool("deletesubjects", false, "soft-delete the subjects of deleted Jsonschemas instead of keeping them")
+	resync := flag.Duration("resync", 0, "how often to reconcile every Jsonschema again (default 5m)")
+	flag.Parse()
+
+	var client jsonschema_controller.Client
+	if *apiServer != "" {
+		client = &jsonschema_controller.RESTClient{Host: *apiServer, Group: *group, Version: *version, Token: *token}
+	} else {
+		inCluster, err := jsonschema_controller.InClusterClient(*group, *version)
+		if err != nil {
+			log.Fatal(err)
+		}
+		client = inCluster
+	}
+
+	registry := cmdutil.RegistryClient(*registryURL, *schemaContext)
+
+	controller := &jsonschema_controller.Controller{
+		Client:         client,
+		Registry:       registry,
+		DeleteSubjects: *deleteSubjects,
+		ResyncPeriod:   *resync,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Printf("registering %s/%s jsonschemas with %s", *group, *version, *registryURL)
+	controller.Run(ctx)
+}
@@ -0,0 +1,412 @@
+// Command schema_registry_admin inspects and manages a Schema Registry:
+// it lists subjects and versions, fetches schemas, registers schema files,
+// deletes subjects and reads or sets compatibility levels and modes.
+//
+// The registry is taken from SCHEMA_REGISTRY_URL, with credentials from
+// SCHEMA_REGISTRY_USERNAME and SCHEMA_REGISTRY_PASSWORD and an optional
+// context from SCHEMA_REGISTRY_CONTEXT. The -url and -context flags
+// override the environment.
+//
+// Exit codes: 0 on success, 1 on any other failure, 2 for invalid usage,
+// 3 when a subject, version or schema does not exist and 4 when a schema
+// is rejected as incompatible.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/infobloxopen/schema-registry-helper/internal/cmdutil"
+	"github.com/infobloxopen/schema-registry-helper/schema_registry_helper"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	exitOK = iota
+	exitFailure
+	exitUsage
+	exitNotFound
+	exitIncompatible
+)
+
+const usage = `usage: schema_registry_admin [-url URL] [-context CONTEXT] [-o table|json|yaml] COMMAND [ARGS]
+
+commands:
+  subjects [-deleted]                     list subjects
+  versions SUBJECT                        list the versions of a subject
+  get SUBJECT [VERSION]                   show a version of a subject, latest by default
+  id ID                                   show the schema with an ID and the versions using it
+  register [-type TYPE] SUBJECT FILE      register a schema file under a subject
+  delete [-permanent] SUBJECT [VERSION]   delete a subject or one of its versions
+  config [-set LEVEL] [SUBJECT]           show or set the compatibility level
+  mode [-set MODE] [SUBJECT]              show or set the mode
+
+Subjects are given with their -key or -value suffix. config and mode
+without a subject apply to the global setting.
+`
+
+var errUsage = errors.New("invalid usage")
+
+// schemaView is how a schema version is printed.
+type schemaView struct {
+	Subject  string                                  `json:"subject,omitempty"`
+	Version  int                                     `json:"version,omitempty"`
+	ID       int                                     `json:"id"`
+	Versions []schema_registry_helper.SubjectVersion `json:"versions,omitempty"`
+	Schema   string                                  `json:"schema,omitempty"`
+}
+
+type deleteView struct {
+	Subject  string `json:"subject"`
+	Versions []int  `json:"versions"`
+}
+
+type settingView struct {
+	Subject       string `json:"subject,omitempty"`
+	Compatibility string `json:"compatibility,omitempty"`
+	Mode          string `json:"mode,omitempty"`
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("schema_registry_admin", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { fmt.Fprint(stderr, usage) }
+	registryURL := flags.String("url", cmdutil.RegistryURL(), "schema registry URL")
+	schemaContext := flags.String("context", cmdutil.RegistryContext(), "schema registry context")
+	format := flags.String("o", "table", "output format: table, json or yaml")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	if *format != "table" && *format != "json" && *format != "yaml" {
+		fmt.Fprintf(stderr, "unknown output format %q\n", *format)
+		return exitUsage
+	}
+
+	client := cmdutil.RegistryClient(*registryURL, *schemaContext)
+
+	cmd := &command{client: client, format: *format, stdout: stdout, stderr: stderr}
+	err := cmd.run(flags.Arg(0), flags.Args()[1:])
+	if err == nil {
+		return exitOK
+	}
+	if errors.Is(err, errUsage) {
+		if err != errUsage {
+			fmt.Fprintf(stderr, "error: %v\n", err)
+		}
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	fmt.Fprintf(stderr, "error: %v\n", err)
+	return exitCode(err)
+}
+
+// exitCode maps registry errors to exit codes by their error_code.
+func exitCode(err error) int {
+	var registryError *schema_registry_helper.RegistryError
+	if !errors.As(err, &registryError) {
+		return exitFailure
+	}
+	switch registryError.ErrorCode {
+	case schema_registry_helper.ErrorCodeSubjectNotFound, schema_registry_helper.ErrorCodeVersionNotFound,
+		schema_registry_helper.ErrorCodeSchemaNotFound:
+		return exitNotFound
+	case schema_registry_helper.ErrorCodeIncompatibleSchema:
+		return exitIncompatible
+	}
+	return exitFailure
+}
+
+type command struct {
+	client *schema_registry_helper.SchemaRegistryClient
+	format string
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func (cmd *command) run(name string, args []string) error {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(cmd.stderr)
+	flags.Usage = func() {}
+	deleted := flags.Bool("deleted", false, "include soft deleted subjects")
+	schemaType := flags.String("type", "", "schema type: JSON, AVRO or PROTOBUF; by default detected from the file")
+	permanent := flags.Bool("permanent", false, "permanently delete a soft deleted subject or version")
+	set := flags.String("set", "", "new value")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	args = flags.Args()
+
+	switch {
+	case name == "subjects" && len(args) == 0:
+		return cmd.subjects(*deleted)
+	case name == "versions" && len(args) == 1:
+		return cmd.versions(args[0])
+	case name == "get" && (len(args) == 1 || len(args) == 2):
+		version := "latest"
+		if len(args) == 2 {
+			version = args[1]
+		}
+		return cmd.get(args[0], version)
+	case name == "id" && len(args) == 1:
+		return cmd.id(args[0])
+	case name == "register" && len(args) == 2:
+		return cmd.register(args[0], args[1], *schemaType)
+	case name == "delete" && (len(args) == 1 || len(args) == 2):
+		version := ""
+		if len(args) == 2 {
+			version = args[1]
+		}
+		return cmd.delete(args[0], version, *permanent)
+	case (name == "config" || name == "mode") && len(args) <= 1:
+		subject := ""
+		if len(args) == 1 {
+			subject = args[0]
+		}
+		return cmd.setting(name, subject, *set)
+	}
+	return errUsage
+}
+
+func (cmd *command) subjects(deleted bool) error {
+	subjects, err := cmd.client.GetSubjects(deleted)
+	if err != nil {
+		return err
+	}
+	return cmd.print(subjects, func(w io.Writer) {
+		fmt.Fprintln(w, "SUBJECT")
+		for _, s := range subjects {
+			fmt.Fprintln(w, s)
+		}
+	})
+}
+
+func (cmd *command) versions(name string) error {
+	subject, isKey, err := splitSubject(name)
+	if err != nil {
+		return err
+	}
+	versions, err := cmd.client.GetSchemaVersions(subject, isKey)
+	if err != nil {
+		return err
+	}
+	return cmd.print(versions, func(w io.Writer) {
+		fmt.Fprintln(w, "VERSION")
+		for _, v := range versions {
+			fmt.Fprintln(w, v)
+		}
+	})
+}
+
+func (cmd *command) get(name, version string) error {
+	subject, isKey, err := splitSubject(name)
+	if err != nil {
+		return err
+	}
+	var schema *schema_registry_helper.Schema
+	if version == "latest" {
+		schema, err = cmd.client.GetLatestSchema(subject, isKey)
+	} else {
+		var n int
+		if n, err = parseVersion(version); err != nil {
+			return err
+		}
+		schema, err = cmd.client.GetSchemaByVersion(subject, n, isKey)
+	}
+	if err != nil {
+		return err
+	}
+	view := schemaView{Subject: name, Version: schema.Version(), ID: schema.ID(), Schema: schema.Schema()}
+	return cmd.print(view, func(w io.Writer) {
+		fmt.Fprintln(w, "SUBJECT\tVERSION\tID")
+		fmt.Fprintf(w, "%s\t%d\t%d\n", view.Subject, view.Version, view.ID)
+	})
+}
+
+func (cmd *command) id(arg string) error {
+	id, err := strconv.Atoi(arg)
+	if err != nil || id <= 0 {
+		return fmt.Errorf("invalid schema ID %q", arg)
+	}
+	schema, err := cmd.client.GetSchema(id)
+	if err != nil {
+		return err
+	}
+	versions, err := cmd.client.GetVersionsBySchemaID(id)
+	if err != nil {
+		return err
+	}
+	view := schemaView{ID: id, Versions: versions, Schema: schema.Schema()}
+	return cmd.print(view, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tSUBJECT\tVERSION")
+		for _, v := range versions {
+			fmt.Fprintf(w, "%d\t%s\t%d\n", id, v.Subject, v.Version)
+		}
+	})
+}
+
+func (cmd *command) register(name, file, schemaType string) error {
+	subject, isKey, err := splitSubject(name)
+	if err != nil {
+		return err
+	}
+	schemaBytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if schemaType == "" {
+		schemaType = schema_registry_helper.DetectSchemaType(file, schemaBytes).String()
+	}
+	schemaType = strings.ToUpper(schemaType)
+	switch schema_registry_helper.SchemaType(schemaType) {
+	case schema_registry_helper.Json, schema_registry_helper.Avro, schema_registry_helper.Protobuf:
+	default:
+		return fmt.Errorf("unknown schema type %q", schemaType)
+	}
+	schema, err := cmd.client.CreateSchema(subject, string(schemaBytes), schema_registry_helper.SchemaType(schemaType), isKey)
+	if err != nil {
+		return err
+	}
+	view := schemaView{Subject: name, Version: schema.Version(), ID: schema.ID()}
+	return cmd.print(view, func(w io.Writer) {
+		fmt.Fprintln(w, "SUBJECT\tVERSION\tID")
+		fmt.Fprintf(w, "%s\t%d\t%d\n", view.Subject, view.Version, view.ID)
+	})
+}
+
+func (cmd *command) delete(name, version string, permanent bool) error {
+	subject, isKey, err := splitSubject(name)
+	if err != nil {
+		return err
+	}
+	view := deleteView{Subject: name}
+	if version == "" {
+		view.Versions, err = cmd.client.DeleteSubject(subject, isKey, permanent)
+		if err != nil {
+			return err
+		}
+	} else {
+		n, err := parseVersion(version)
+		if err != nil {
+			return err
+		}
+		if err := cmd.client.DeleteSchemaVersion(subject, n, isKey, permanent); err != nil {
+			return err
+		}
+		view.Versions = []int{n}
+	}
+	return cmd.print(view, func(w io.Writer) {
+		fmt.Fprintln(w, "SUBJECT\tVERSION")
+		for _, v := range view.Versions {
+			fmt.Fprintf(w, "%s\t%d\n", view.Subject, v)
+		}
+	})
+}
+
+func (cmd *command) setting(name, subjectName, value string) error {
+	subject, isKey := "", false
+	if subjectName != "" {
+		var err error
+		if subject, isKey, err = splitSubject(subjectName); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	value = strings.ToUpper(value)
+	switch {
+	case name == "config" && value != "":
+		err = cmd.client.SetCompatibility(subject, isKey, value)
+	case name == "config":
+		value, err = cmd.client.GetCompatibility(subject, isKey)
+	case value != "":
+		err = cmd.client.SetMode(subject, isKey, value)
+	default:
+		value, err = cmd.client.GetMode(subject, isKey)
+	}
+	if err != nil {
+		return err
+	}
+
+	view := settingView{Subject: subjectName}
+	heading := "COMPATIBILITY"
+	if name == "config" {
+		view.Compatibility = value
+	} else {
+		view.Mode = value
+		heading = "MODE"
+	}
+	if subjectName == "" {
+		subjectName = "(global)"
+	}
+	return cmd.print(view, func(w io.Writer) {
+		fmt.Fprintf(w, "SUBJECT\t%s\n", heading)
+		fmt.Fprintf(w, "%s\t%s\n", subjectName, value)
+	})
+}
+
+// print writes value as JSON or YAML, or calls table. A schema shown as a
+// table is printed in full after the table.
+func (cmd *command) print(value interface{}, table func(w io.Writer)) error {
+	switch cmd.format {
+	case "json":
+		bs, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(cmd.stdout, string(bs))
+		return err
+	case "yaml":
+		bs, err := yaml.Marshal(value)
+		if err != nil {
+			return err
+		}
+		_, err = cmd.stdout.Write(bs)
+		return err
+	}
+	w := tabwriter.NewWriter(cmd.stdout, 0, 4, 2, ' ', 0)
+	table(w)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if view, ok := value.(schemaView); ok && view.Schema != "" {
+		_, err := fmt.Fprintf(cmd.stdout, "\n%s\n", view.Schema)
+		return err
+	}
+	return nil
+}
+
+// splitSubject turns a subject name into the subject and key flag used by
+// SchemaRegistryClient.
+func splitSubject(name string) (string, bool, error) {
+	if subject := strings.TrimSuffix(name, "-key"); subject != name && subject != "" {
+		return subject, true, nil
+	}
+	if subject := strings.TrimSuffix(name, "-value"); subject != name && subject != "" {
+		return subject, false, nil
+	}
+	return "", false, fmt.Errorf("%w: subject %q must end in -key or -value", errUsage, name)
+}
+
+func parseVersion(version string) (int, error) {
+	n, err := strconv.Atoi(version)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid version %q", version)
+	}
+	return n, nil
+}
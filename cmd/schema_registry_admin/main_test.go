@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/infobloxopen/schema-registry-helper/schema_registry_server"
+)
+
+func TestCommands(t *testing.T) {
+	s, err := schema_registry_server.NewServer(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	file := filepath.Join(t.TempDir(), "user.json")
+	if err := ioutil.WriteFile(file, []byte(`{"type": "object"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args []string
+		code int
+		want string
+	}{
+		{args: []string{"register", "users-value", file}, code: exitOK, want: "users-value  1        1"},
+		{args: []string{"-o", "json", "subjects"}, code: exitOK, want: `"users-value"`},
+		{args: []string{"-o", "yaml", "get", "users-value"}, code: exitOK, want: "schema: '{\"type\": \"object\"}'"},
+		{args: []string{"get", "users-value", "2"}, code: exitNotFound},
+		{args: []string{"id", "1"}, code: exitOK, want: "1   users-value  1"},
+		{args: []string{"versions", "accounts-value"}, code: exitNotFound},
+		{args: []string{"versions", "users"}, code: exitUsage},
+		{args: []string{"config", "-set", "full"}, code: exitOK, want: "(global)  FULL"},
+		{args: []string{"-o", "json", "config", "users-value"}, code: exitOK, want: `"compatibility": "FULL"`},
+		{args: []string{"mode", "-set", "READONLY", "users-value"}, code: exitOK},
+		{args: []string{"register", "users-value", file}, code: exitFailure},
+		{args: []string{"mode", "-set", "READWRITE", "users-value"}, code: exitOK},
+		{args: []string{"delete", "-permanent", "users-value"}, code: exitFailure},
+		{args: []string{"delete", "users-value"}, code: exitOK, want: "users-value  1"},
+		{args: []string{"subjects", "-deleted"}, code: exitOK, want: "users-value"},
+		{args: []string{"frobnicate"}, code: exitUsage},
+		{args: []string{"-o", "xml", "subjects"}, code: exitUsage},
+	}
+	for _, tc := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(append([]string{"-url", server.URL}, tc.args...), &stdout, &stderr)
+		if code != tc.code || !strings.Contains(stdout.String(), tc.want) {
+			t.Errorf("%v: got %d %q %q, wanted %d containing %q",
+				tc.args, code, stdout.String(), stderr.String(), tc.code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+// Command schema_registry_server runs a local, file-backed Schema Registry
+// for development and tests.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/infobloxopen/schema-registry-helper/schema_registry_server"
+)
+
+func main() {
+	listen := flag.String("listen", ":8081", "address to serve the registry API on")
+	dir := flag.String("dir", "schema-registry-data", "directory the registry state is kept in")
+	flag.Parse()
+
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		log.Fatal(err)
+	}
+	server, err := schema_registry_server.NewServer(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("serving schema registry from %s on %s", *dir, *listen)
+	log.Fatal(http.ListenAndServe(*listen, server))
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, "schema_to_cr.yaml", `
+inputs: [schemas, more-schemas]
+outputPath: charts/templates
+group: schemaregistry.infoblox.com
+crNamespace: atlas.tagging
+omit: [read, list]
+guard: .Values.events.enabled
+overrides:
+  - path: internal
+    skip: true
+  - path: domain/*
+    crNamespace: domain
+    exclude: ["*Test.jsonschema"]
+`)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.Inputs, []string{"schemas", "more-schemas"}) || cfg.Group != "schemaregistry.infoblox.com" ||
+		cfg.Guard != ".Values.events.enabled" || cfg.Target != helmTarget || cfg.Separator != "-" {
+		t.Errorf("got %+v", cfg)
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, skip := cfg.rulesFor(namespaceDir{RelPath: "internal"}); !skip {
+		t.Error("internal was not skipped")
+	}
+	rules, skip := cfg.rulesFor(namespaceDir{RelPath: "domain/service"})
+	if skip || rules.CRNamespace != "domain" || !reflect.DeepEqual(rules.Omit, []string{"read", "list"}) {
+		t.Errorf("got rules %+v", rules)
+	}
+	if _, skipReason, _ := getSchemaName(rules, namespaceDir{Name: "domain-service", RelPath: "domain/service"}, "EventTest.jsonschema"); skipReason == "" {
+		t.Error("excluded file was not skipped")
+	}
+}
+
+func TestLoadJSONConfig(t *testing.T) {
+	path := writeConfig(t, "schema_to_cr.json", `{"inputs": ["schemas"], "target": "kustomize", "crNamespace": "dev"}`)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Target != kustomizeTarget || cfg.CRNamespace != "dev" {
+		t.Errorf("got %+v", cfg)
+	}
+}
+
+var testInvalidConfigs = []struct {
+	content string
+	want    string
+}{
+	{content: "grup: schemaregistry.infoblox.com\n", want: `unknown field "grup"`},
+	{content: "overrides:\n  - path: pb\n    colour: red\n", want: `unknown field "colour"`},
+	{content: "target: terraform\n", want: `unknown target "terraform"`},
+	{content: "target: kubernetes\n", want: "requires crNamespace"},
+	{content: "overrides:\n  - crNamespace: x\n", want: "override 1 has no path"},
+	{content: "nameTemplate: \"{{ .Type\"\n", want: "invalid name template"},
+	{content: "nameTemplate: \"{{ .Entity }}\"\n", want: "can't evaluate field Entity"},
+	{content: "separator: /\n", want: "must not contain a path separator"},
+	{content: "exclude: [\"type:re:(\"]\n", want: "invalid pattern"},
+	{content: "include: [\"[\"]\n", want: "invalid pattern"},
+	{content: "crd:\n  versions: [v1, V2]\n", want: `invalid version "V2"`},
+	{content: "crd:\n  versions: [v1, v1]\n", want: "listed twice"},
+	{content: "crd:\n  storageVersion: v2\n", want: "storage version v2 is not one of the versions"},
+}
+
+func TestInvalidConfig(t *testing.T) {
+	for _, tc := range testInvalidConfigs {
+		cfg, err := loadConfig(writeConfig(t, "schema_to_cr.yaml", tc.content))
+		if err == nil {
+			err = cfg.validate()
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: got %v, wanted an error containing %q", tc.content, err, tc.want)
+		}
+	}
+}
+
+func TestNameTemplate(t *testing.T) {
+	dir := filepath.Dir(writeConfig(t, "Event.jsonschema", `{"type": "object"}`))
+	rules := namingRules{CRNamespace: "dev", NameTemplate: "{{ .CRNamespace }}.{{ .Namespace | upper }}.{{ .Type }}"}
+	name, skipReason, err := getSchemaName(rules, namespaceDir{Name: "pb", Path: dir, RelPath: "pb"}, "Event.jsonschema")
+	if err != nil || skipReason != "" || name != "dev.PB.Event" {
+		t.Errorf("got %q %q %v", name, skipReason, err)
+	}
+}
+
+func TestDefaultNameValidated(t *testing.T) {
+	rules := namingRules{CRNamespace: "{{ .Release.Namespace }}"}
+	name, _, err := getSchemaName(rules, namespaceDir{Name: "pb", RelPath: "pb"}, "Event.jsonschema")
+	if err != nil || name != "{{ .Release.Namespace }}-pb-Event" {
+		t.Errorf("got %q %v", name, err)
+	}
+	for _, fileName := range []string{"Tag Event.jsonschema", "Événement.jsonschema", strings.Repeat("x", 250) + ".jsonschema"} {
+		if name, _, err := getSchemaName(rules, namespaceDir{Name: "pb", RelPath: "pb"}, fileName); err == nil {
+			t.Errorf("%q: got %q, wanted an invalid topic name", fileName, name)
+		}
+	}
+}
+
+var testProtoNames = []struct {
+	template string
+	want     string
+	err      string
+}{
+	{template: "{{ .Package }}.{{ .Type | lower }}.v1", want: "atlas.tagging.tagevent.v1"},
+	{template: "{{ .GoPackageName }}-{{ .Directory }}-{{ .Path | replace \"/\" \".\" }}", want: "pb-service-domain.service"},
+	{template: "{{ .GoPackage | base }}.{{ .Type | kebabcase }}", want: "pb.tag-event"},
+	{template: "{{ .Namespace }} {{ .Type }}", err: "not a valid topic name"},
+	{template: "{{ .Type | snakecase }}", want: "tag_event"},
+	{template: "{{ .CRNamespace }}-{{ .Type | lower }}", want: "{{ .Release.Namespace }}-tagevent"},
+}
+
+func TestProtoNameTemplate(t *testing.T) {
+	dir := filepath.Dir(writeConfig(t, "TagEvent.proto", `syntax = "proto3";
+package atlas.tagging;
+option go_package = "github.com/infobloxopen/tagging/pb;pb";
+message TagEvent {}
+`))
+	namespace := namespaceDir{Name: "domain-service", Path: dir, RelPath: "domain/service"}
+	for _, tc := range testProtoNames {
+		rules := namingRules{CRNamespace: "{{ .Release.Namespace }}", NameTemplate: tc.template}
+		name, _, err := getSchemaName(rules, namespace, "TagEvent.proto")
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%q: got %q %v, wanted an error containing %q", tc.template, name, err, tc.err)
+			}
+			continue
+		}
+		if err != nil || name != tc.want {
+			t.Errorf("%q: got %q %v, wanted %q", tc.template, name, err, tc.want)
+		}
+	}
+}
+
+var testPatterns = []struct {
+	pattern string
+	dir     string
+	file    string
+	want    bool
+}{
+	{pattern: "*.jsonschema", dir: "pb", file: "Event.jsonschema", want: true},
+	{pattern: "pb/*", dir: "pb", file: "Event.jsonschema", want: true},
+	{pattern: "pb/*", dir: "domain/pb", file: "Event.jsonschema", want: false},
+	{pattern: "path:domain/*/Event.*", dir: "domain/pb", file: "Event.proto", want: true},
+	{pattern: "dir:domain/*", dir: "domain/pb", file: "Event.proto", want: true},
+	{pattern: "dir:re:^legacy(/|$)", dir: "legacy/v1", file: "Event.proto", want: true},
+	{pattern: "ext:.proto", dir: "pb", file: "Event.proto", want: true},
+	{pattern: "ext:re:^\\.(jsonschema|avsc)$", dir: "pb", file: "Event.proto", want: false},
+	{pattern: "type:re:^Test", dir: "pb", file: "TestEvent.jsonschema", want: true},
+	{pattern: "type:*~", dir: "pb", file: "Event.jsonschema~", want: false},
+	{pattern: "*~", dir: "pb", file: "Event.jsonschema~", want: true},
+	{pattern: "re:(?i)^readme", dir: "pb", file: "README.md", want: true},
+}
+
+func TestMatchPattern(t *testing.T) {
+	for _, tc := range testPatterns {
+		got, err := matchPattern(tc.pattern, tc.dir, tc.file)
+		if err != nil || got != tc.want {
+			t.Errorf("%q %s/%s: got %v %v, wanted %v", tc.pattern, tc.dir, tc.file, got, err, tc.want)
+		}
+	}
+}
+
+func TestSkipReason(t *testing.T) {
+	rules := namingRules{CRNamespace: "dev", Omit: []string{"read"}, Include: []string{"ext:.jsonschema"}, Exclude: []string{"type:re:Test$"}}
+	namespace := namespaceDir{Name: "pb", RelPath: "pb"}
+	for file, want := range map[string]string{
+		"ReadEvent.jsonschema":  `omitted prefix "read"`,
+		"Notes.md":              "no include pattern",
+		"EventTest.jsonschema":  `exclude pattern "type:re:Test$"`,
+		"Event.jsonschema":      "",
+		"Event.jsonschema.orig": "no include pattern",
+	} {
+		_, skipReason, err := getSchemaName(rules, namespace, file)
+		if err != nil || !strings.Contains(skipReason, want) || (want == "") != (skipReason == "") {
+			t.Errorf("%v: got %q %v, wanted %q", file, skipReason, err, want)
+		}
+	}
+}
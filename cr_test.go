@@ -13,10 +13,11 @@ var testCRs = []struct {
 }{
 	{
 		input: CR{
-			Name:   "spec-test",
-			LName:  "metadata-name",
-			Schema: "schema",
-			Group:  "group",
+			Name:    "spec-test",
+			LName:   "metadata-name",
+			Schema:  "schema",
+			Group:   "group",
+			Version: "v1",
 		},
 		outputPath: "cr.one.yaml",
 	},
@@ -35,7 +36,23 @@ var testCRs = []struct {
         }
     }
 }`,
-			Group: "group",
+			Group:   "group",
+			Version: "v1",
+		},
+	},
+	{
+		outputPath: "cr.three.yaml",
+		input: CR{
+			Name:  "spec-test-3",
+			LName: "metadata-name-3",
+			Schema: `{
+    "type": "record",
+    "name": "User",
+    "fields": [{"name": "name", "type": "string"}]
+}`,
+			Group:      "group",
+			SchemaType: "AVRO",
+			Version:    "v1",
 		},
 	},
 }
@@ -59,3 +76,30 @@ func TestCustomRes(t *testing.T) {
 		}
 	}
 }
+
+func TestCRVersion(t *testing.T) {
+	schemaPath := filepath.Join(t.TempDir(), "Event.json")
+	if err := ioutil.WriteFile(schemaPath, []byte(`{"type": "object"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	namespace := namespaceDir{Name: "service", Path: filepath.Dir(schemaPath)}
+	for _, tc := range []struct {
+		crd  CRD
+		want string
+	}{
+		{CRD{}, `apiVersion: "group/v1"`},
+		{CRD{Versions: []string{"v1beta1", "v1"}}, `apiVersion: "group/v1beta1"`},
+		{CRD{Versions: []string{"v1", "v2"}, StorageVersion: "v2"}, `apiVersion: "group/v2"`},
+	} {
+		cfg := defaultConfig()
+		cfg.Group = "group"
+		cfg.CRD = tc.crd
+		got, err := strCreateCR(schemaPath, namespace, "service-Event", "service-event", cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(got, tc.want+"\n") {
+			t.Errorf("%+v: expected %s, got\n%s", tc.crd, tc.want, got)
+		}
+	}
+}
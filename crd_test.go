@@ -17,6 +17,18 @@ var testCRDs = []struct {
 		},
 		outputPath: "crd.one.yaml",
 	},
+	{
+		input: CRD{
+			Group:          "group",
+			Versions:       []string{"v1", "v2beta1"},
+			StorageVersion: "v2beta1",
+			Status:         true,
+			PrinterColumns: true,
+			Required:       true,
+			OptionalFields: true,
+		},
+		outputPath: "crd.two.yaml",
+	},
 }
 
 func TestCRD(t *testing.T) {
@@ -39,3 +51,51 @@ func TestCRD(t *testing.T) {
 	}
 
 }
+
+func TestConfigCRD(t *testing.T) {
+	cfg, err := loadConfig(writeConfig(t, "schema_to_cr.yaml", "crd:\n  versions: [v1, v2]\n  storageVersion: v2\n  printerColumns: true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	crd := cfg.outputOptions().CRD
+	if crd.Status || !crd.PrinterColumns || crd.Required || crd.OptionalFields || crd.StorageVersion != "v2" {
+		t.Errorf("got %+v", crd)
+	}
+}
+
+func TestDefaultCRD(t *testing.T) {
+	// The CRD options are off by default, so the CRD is the legacy one.
+	bs, err := ioutil.ReadFile(filepath.Join("testdata", "crd.one.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crd := defaultConfig().CRD
+	crd.Group = "group/v1"
+	s, err := createCRD(crd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(bs)) != strings.TrimSpace(s) {
+		t.Errorf("got:\n%q\nwanted:\n%q", s, bs)
+	}
+}
+
+func TestCRDTemplateDefaults(t *testing.T) {
+	tmpl := `{{ range .Versions }}{{ . }} storage: {{ eq . $.StorageVersion }}
+{{ end }}`
+	for _, tc := range []struct {
+		crd  CRD
+		want string
+	}{
+		{CRD{}, "v1 storage: true\n"},
+		{CRD{Versions: []string{"v1", "v2"}}, "v1 storage: true\nv2 storage: false\n"},
+		{CRD{Versions: []string{"v1", "v2"}, StorageVersion: "v2"}, "v1 storage: false\nv2 storage: true\n"},
+	} {
+		if got := renderCRD(tc.crd, true, "", tmpl); got != tc.want {
+			t.Errorf("%+v: got %q, wanted %q", tc.crd, got, tc.want)
+		}
+	}
+}
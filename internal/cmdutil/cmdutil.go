@@ -0,0 +1,37 @@
+// Package cmdutil holds the settings shared by the commands under cmd.
+package cmdutil
+
+import (
+	"os"
+
+	"github.com/infobloxopen/schema-registry-helper/schema_registry_helper"
+)
+
+// EnvOr returns the environment variable name, or fallback if it is unset
+// or empty.
+func EnvOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// RegistryURL and RegistryContext are the defaults of the -url and
+// -context flags, taken from SCHEMA_REGISTRY_URL and
+// SCHEMA_REGISTRY_CONTEXT.
+func RegistryURL() string {
+	return EnvOr("SCHEMA_REGISTRY_URL", "http://localhost:8081")
+}
+
+func RegistryContext() string {
+	return os.Getenv("SCHEMA_REGISTRY_CONTEXT")
+}
+
+// RegistryClient returns a client for the registry at registryURL, scoped
+// to schemaContext, with credentials from SCHEMA_REGISTRY_USERNAME and
+// SCHEMA_REGISTRY_PASSWORD.
+func RegistryClient(registryURL, schemaContext string) *schema_registry_helper.SchemaRegistryClient {
+	client := schema_registry_helper.CreateSchemaRegistryClient(registryURL)
+	client.SetCredentials(os.Getenv("SCHEMA_REGISTRY_USERNAME"), os.Getenv("SCHEMA_REGISTRY_PASSWORD"))
+	return client.WithContext(schemaContext)
+}
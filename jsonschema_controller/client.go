@@ -0,0 +1,246 @@
+package jsonschema_controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Client is the part of the Kubernetes API the controller uses, for the
+// Jsonschema resources in every namespace.
+type Client interface {
+	// List returns every Jsonschema and the resource version to watch
+	// from.
+	List(ctx context.Context) (*JsonschemaList, error)
+	// Watch calls handle for each change after resourceVersion until ctx
+	// is done or the API ends the watch. An ERROR event, such as an
+	// expired resource version, is returned as an error.
+	Watch(ctx context.Context, resourceVersion string, handle func(eventType string, obj *Jsonschema)) error
+	// SetFinalizers replaces the finalizers of obj, provided it has not
+	// changed since it was read, and returns the updated object.
+	SetFinalizers(ctx context.Context, obj *Jsonschema, finalizers []string) (*Jsonschema, error)
+	// SetStatus replaces the status of obj and returns the updated object.
+	SetStatus(ctx context.Context, obj *Jsonschema, status JsonschemaStatus) (*Jsonschema, error)
+}
+
+// ErrStatusNotSaved is returned by SetStatus when the CRD has no status
+// schema, so the API server drops the status.
+var ErrStatusNotSaved = errors.New("the status was not saved; generate the CRD with the status option")
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	resource          = "jsonschemas"
+)
+
+// RESTClient is a Client using the Kubernetes REST API. Changes are sent
+// as JSON merge patches, so fields the controller does not know about are
+// kept.
+type RESTClient struct {
+	// Host is the API server URL, e.g. https://10.0.0.1:443.
+	Host string
+	// Group and Version are the API group and version of the CRD.
+	Group   string
+	Version string
+	// Token is sent as a bearer token if set. TokenFile, if set, is read
+	// for every request instead, so that rotated tokens are picked up.
+	Token     string
+	TokenFile string
+	// HTTPClient is http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+var _ Client = (*RESTClient)(nil)
+
+// InClusterClient returns a RESTClient using the service account of the
+// pod it runs in.
+func InClusterClient(group, version string) (*RESTClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a cluster: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	ca, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in %s/ca.crt", serviceAccountDir)
+	}
+	return &RESTClient{
+		Host:      "https://" + net.JoinHostPort(host, port),
+		Group:     group,
+		Version:   version,
+		TokenFile: serviceAccountDir + "/token",
+		HTTPClient: &http.Client{Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		}},
+	}, nil
+}
+
+func (c *RESTClient) path(obj *Jsonschema, subresource string) string {
+	path := fmt.Sprintf("/apis/%s/%s", c.Group, c.Version)
+	if obj == nil {
+		return path + "/" + resource
+	}
+	path += fmt.Sprintf("/namespaces/%s/%s/%s", url.PathEscape(obj.Metadata.Namespace), resource, url.PathEscape(obj.Metadata.Name))
+	if subresource != "" {
+		path += "/" + subresource
+	}
+	return path
+}
+
+func (c *RESTClient) request(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		bs, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(bs)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.Host, "/")+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+	}
+	token := c.Token
+	if c.TokenFile != "" {
+		bs, err := ioutil.ReadFile(c.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(bs))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, decodeAPIError(resp.StatusCode, resp.Body)
+	}
+	return resp, nil
+}
+
+// decodeAPIError reads a Kubernetes Status object, falling back to the
+// HTTP status if the body is not one.
+func decodeAPIError(code int, body io.Reader) error {
+	bs, _ := ioutil.ReadAll(body)
+	apiError := &APIError{}
+	if err := json.Unmarshal(bs, apiError); err != nil || apiError.Message == "" {
+		apiError.Message = strings.TrimSpace(string(bs))
+	}
+	if apiError.Code == 0 {
+		apiError.Code = code
+	}
+	if apiError.Reason == "" {
+		apiError.Reason = http.StatusText(code)
+	}
+	return apiError
+}
+
+func (c *RESTClient) do(ctx context.Context, method, path string, body, result interface{}) error {
+	resp, err := c.request(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func (c *RESTClient) List(ctx context.Context) (*JsonschemaList, error) {
+	list := &JsonschemaList{}
+	if err := c.do(ctx, "GET", c.path(nil, ""), nil, list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (c *RESTClient) Watch(ctx context.Context, resourceVersion string, handle func(eventType string, obj *Jsonschema)) error {
+	query := url.Values{"watch": {"true"}, "resourceVersion": {resourceVersion}}
+	resp, err := c.request(ctx, "GET", c.path(nil, "")+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event watchEvent
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if event.Type == Error {
+			return decodeAPIError(http.StatusInternalServerError, bytes.NewReader(event.Object))
+		}
+		obj := &Jsonschema{}
+		if err := json.Unmarshal(event.Object, obj); err != nil {
+			return err
+		}
+		handle(event.Type, obj)
+	}
+}
+
+func (c *RESTClient) SetFinalizers(ctx context.Context, obj *Jsonschema, finalizers []string) (*Jsonschema, error) {
+	if finalizers == nil {
+		finalizers = []string{}
+	}
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"finalizers":      finalizers,
+			"resourceVersion": obj.Metadata.ResourceVersion,
+		},
+	}
+	updated := &Jsonschema{}
+	if err := c.do(ctx, "PATCH", c.path(obj, ""), patch, updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// SetStatus patches the status subresource. If the CRD has none, the
+// status is patched on the resource itself; ErrStatusNotSaved is returned
+// if the CRD's schema then drops it.
+func (c *RESTClient) SetStatus(ctx context.Context, obj *Jsonschema, status JsonschemaStatus) (*Jsonschema, error) {
+	patch := map[string]interface{}{"status": status}
+	updated := &Jsonschema{}
+	err := c.do(ctx, "PATCH", c.path(obj, "status"), patch, updated)
+	if err == nil {
+		return updated, nil
+	}
+	if !IsNotFound(err) {
+		return nil, err
+	}
+	updated = &Jsonschema{}
+	if err := c.do(ctx, "PATCH", c.path(obj, ""), patch, updated); err != nil {
+		return nil, err
+	}
+	if updated.Status.Subject != status.Subject || len(updated.Status.Conditions) != len(status.Conditions) {
+		return nil, fmt.Errorf("%s: %w", obj.Key(), ErrStatusNotSaved)
+	}
+	return updated, nil
+}
@@ -0,0 +1,148 @@
+package jsonschema_controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRESTClient(t *testing.T) {
+	type request struct {
+		method, path, query, contentType, auth, body string
+	}
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, request{r.Method, r.URL.Path, r.URL.RawQuery, r.Header.Get("Content-Type"), r.Header.Get("Authorization"), string(body)})
+		switch {
+		case r.URL.Query().Get("watch") == "true":
+			fmt.Fprintln(w, `{"type":"ADDED","object":{"metadata":{"name":"a","namespace":"ns","resourceVersion":"11"},"spec":{"name":"a","schema":"{}"}}}`)
+			fmt.Fprintln(w, `{"type":"DELETED","object":{"metadata":{"name":"a","namespace":"ns","resourceVersion":"12"},"spec":{"name":"a","schema":"{}"}}}`)
+		case r.Method == "GET":
+			fmt.Fprint(w, `{"metadata":{"resourceVersion":"10"},"items":[{"metadata":{"name":"a","namespace":"ns","resourceVersion":"9","generation":2},"spec":{"name":"a","schema":"{}","isKey":true}}]}`)
+		case r.URL.Path == "/apis/example.com/v1/namespaces/ns/jsonschemas/missing":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"kind":"Status","code":404,"reason":"NotFound","message":"jsonschemas \"missing\" not found"}`)
+		default:
+			w.Write(body)
+		}
+	}))
+	defer server.Close()
+
+	client := &RESTClient{Host: server.URL + "/", Group: "example.com", Version: "v1", Token: "secret"}
+	ctx := context.Background()
+
+	list, err := client.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Metadata.ResourceVersion != "10" || len(list.Items) != 1 || !list.Items[0].Spec.IsKey || list.Items[0].Metadata.Generation != 2 {
+		t.Errorf("unexpected list %+v", list)
+	}
+
+	var events []string
+	err = client.Watch(ctx, "10", func(eventType string, obj *Jsonschema) {
+		events = append(events, eventType+" "+obj.Key()+"@"+obj.Metadata.ResourceVersion)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(events) != "[ADDED ns/a@11 DELETED ns/a@12]" {
+		t.Errorf("unexpected events %v", events)
+	}
+
+	obj := &list.Items[0]
+	if _, err := client.SetFinalizers(ctx, obj, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.SetStatus(ctx, obj, JsonschemaStatus{Subject: "a-key", ID: 3, Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	obj.Metadata.Name = "missing"
+	if _, err := client.SetFinalizers(ctx, obj, []string{Finalizer}); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	expected := []request{
+		{"GET", "/apis/example.com/v1/jsonschemas", "", "", "Bearer secret", ""},
+		{"GET", "/apis/example.com/v1/jsonschemas", "resourceVersion=10&watch=true", "", "Bearer secret", ""},
+		{"PATCH", "/apis/example.com/v1/namespaces/ns/jsonschemas/a", "", "application/merge-patch+json", "Bearer secret",
+			`{"metadata":{"finalizers":[],"resourceVersion":"9"}}`},
+		{"PATCH", "/apis/example.com/v1/namespaces/ns/jsonschemas/a/status", "", "application/merge-patch+json", "Bearer secret",
+			`{"status":{"subject":"a-key","id":3,"version":1}}`},
+		{"PATCH", "/apis/example.com/v1/namespaces/ns/jsonschemas/missing", "", "application/merge-patch+json", "Bearer secret",
+			`{"metadata":{"finalizers":["schemaregistry.infoblox.com/finalizer"],"resourceVersion":"9"}}`},
+	}
+	if len(requests) != len(expected) {
+		t.Fatalf("expected %d requests, got %+v", len(expected), requests)
+	}
+	for i := range expected {
+		if requests[i] != expected[i] {
+			t.Errorf("request %d: expected %+v, got %+v", i, expected[i], requests[i])
+		}
+	}
+}
+
+func TestRESTClientStatusFallback(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/apis/example.com/v1/namespaces/ns/jsonschemas/a/status", "/apis/example.com/v1/namespaces/ns/jsonschemas/pruned/status":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"kind":"Status","code":404,"reason":"NotFound","message":"the server could not find the requested resource"}`)
+		case "/apis/example.com/v1/namespaces/ns/jsonschemas/pruned":
+			fmt.Fprint(w, `{"metadata":{"name":"pruned","namespace":"ns"},"spec":{"name":"pruned","schema":"{}"}}`)
+		default:
+			w.Write(body)
+		}
+	}))
+	defer server.Close()
+
+	client := &RESTClient{Host: server.URL, Group: "example.com", Version: "v1"}
+	ctx := context.Background()
+	status := JsonschemaStatus{Subject: "a-value", ID: 3, Version: 1}
+	obj := &Jsonschema{Metadata: ObjectMeta{Name: "a", Namespace: "ns"}}
+	updated, err := client.SetStatus(ctx, obj, status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Status.Subject != "a-value" {
+		t.Errorf("unexpected status %+v", updated.Status)
+	}
+	expected := "[/apis/example.com/v1/namespaces/ns/jsonschemas/a/status /apis/example.com/v1/namespaces/ns/jsonschemas/a]"
+	if fmt.Sprint(paths) != expected {
+		t.Errorf("expected requests to %s, got %v", expected, paths)
+	}
+
+	// A CRD without a status schema drops the status.
+	obj.Metadata.Name = "pruned"
+	if _, err := client.SetStatus(ctx, obj, status); !errors.Is(err, ErrStatusNotSaved) {
+		t.Errorf("expected an error for a dropped status, got %v", err)
+	}
+}
+
+func TestRESTClientWatchError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"type":   "ERROR",
+			"object": map[string]interface{}{"kind": "Status", "code": 410, "reason": "Expired", "message": "too old resource version"},
+		})
+	}))
+	defer server.Close()
+
+	client := &RESTClient{Host: server.URL, Group: "example.com", Version: "v1"}
+	err := client.Watch(context.Background(), "1", func(string, *Jsonschema) {
+		t.Error("unexpected event")
+	})
+	apiError, ok := err.(*APIError)
+	if !ok || apiError.Code != 410 || apiError.Reason != "Expired" {
+		t.Errorf("expected a 410 error, got %v", err)
+	}
+}
@@ -0,0 +1,354 @@
+package jsonschema_controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/infobloxopen/schema-registry-helper/schema_registry_helper"
+)
+
+const (
+	defaultResyncPeriod = 5 * time.Minute
+	defaultRetryDelay   = 10 * time.Second
+)
+
+// subjectDeleter and compatibilitySetter are implemented by
+// SchemaRegistryClient and MemorySchemaRegistry, but are not part of the
+// SchemaRegistry interface.
+type subjectDeleter interface {
+	DeleteSubject(subject string, isKey bool, permanent bool) ([]int, error)
+}
+
+type compatibilitySetter interface {
+	SetCompatibility(subject string, isKey bool, level string) error
+}
+
+// Controller registers the schemas of Jsonschema resources.
+type Controller struct {
+	Client   Client
+	Registry schema_registry_helper.SchemaRegistry
+	// DeleteSubjects soft-deletes the subject of a deleted Jsonschema.
+	// Otherwise it is kept in the registry. DeleteSubjectAnnotation
+	// overrides it for a single resource.
+	DeleteSubjects bool
+	// ResyncPeriod is how often every resource is reconciled again, 5
+	// minutes if zero. RetryDelay is how long to wait before retrying a
+	// failure, 10 seconds if zero.
+	ResyncPeriod time.Duration
+	RetryDelay   time.Duration
+	// Logf is log.Printf if nil.
+	Logf func(format string, args ...interface{})
+
+	// now is time.Now if nil.
+	now func() time.Time
+	// statusWarning logs ErrStatusNotSaved only once.
+	statusWarning sync.Once
+}
+
+func (c *Controller) logf(format string, args ...interface{}) {
+	if c.Logf != nil {
+		c.Logf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+func (c *Controller) timestamp() string {
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+	return now().UTC().Format(time.RFC3339)
+}
+
+// Run reconciles every Jsonschema, then watches for changes, until ctx is
+// done. All resources are listed and reconciled again every ResyncPeriod,
+// when the watch ends, and RetryDelay after a failure.
+func (c *Controller) Run(ctx context.Context) error {
+	resync, retry := c.ResyncPeriod, c.RetryDelay
+	if resync == 0 {
+		resync = defaultResyncPeriod
+	}
+	if retry == 0 {
+		retry = defaultRetryDelay
+	}
+	for ctx.Err() == nil {
+		list, err := c.Client.List(ctx)
+		if err != nil {
+			c.logf("listing jsonschemas: %v", err)
+			sleep(ctx, retry)
+			continue
+		}
+		failed := false
+		for i := range list.Items {
+			obj := &list.Items[i]
+			if err := c.Reconcile(ctx, obj); err != nil {
+				c.logf("%s: %v", obj.Key(), err)
+				failed = true
+			}
+		}
+
+		wait := resync
+		if failed {
+			wait = retry
+		}
+		watchCtx, cancel := context.WithTimeout(ctx, wait)
+		var retryOnce sync.Once
+		err = c.Client.Watch(watchCtx, list.Metadata.ResourceVersion, func(eventType string, obj *Jsonschema) {
+			if eventType == Deleted || c.upToDate(obj) {
+				return
+			}
+			if err := c.Reconcile(ctx, obj); err != nil {
+				c.logf("%s: %v", obj.Key(), err)
+				// Relist, and so retry, after the delay.
+				retryOnce.Do(func() { time.AfterFunc(retry, cancel) })
+			}
+		})
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			c.logf("watching jsonschemas: %v", err)
+			sleep(ctx, retry)
+		}
+	}
+	return nil
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+// upToDate reports whether obj needs no work: it has the finalizer, is not
+// being deleted, and its current generation was registered. Such events,
+// including those caused by the controller's own status updates, are not
+// reconciled until the next resync.
+func (c *Controller) upToDate(obj *Jsonschema) bool {
+	ready := obj.Status.condition(ConditionReady)
+	return obj.Metadata.DeletionTimestamp == nil && obj.hasFinalizer() &&
+		obj.Status.ObservedGeneration == obj.Metadata.Generation && ready != nil && ready.Status == "True"
+}
+
+// Reconcile brings the registry and the status of obj in line with its
+// spec: the finalizer is added, the schema registered and the status
+// updated. A resource being deleted has its subject deleted, if
+// DeleteSubjects or its annotation ask for it, and its finalizer removed.
+// If the registry refuses the deletion, the subject is kept and the
+// refusal recorded in the status. Errors worth retrying are returned; an
+// invalid spec is only reported in the status.
+func (c *Controller) Reconcile(ctx context.Context, obj *Jsonschema) error {
+	if obj.Metadata.DeletionTimestamp != nil {
+		return c.finalize(ctx, obj)
+	}
+	if !obj.hasFinalizer() {
+		finalizers := append(append([]string(nil), obj.Metadata.Finalizers...), Finalizer)
+		updated, err := c.Client.SetFinalizers(ctx, obj, finalizers)
+		if err != nil {
+			return fmt.Errorf("adding finalizer: %v", err)
+		}
+		obj = updated
+	}
+
+	status, registerErr := c.register(obj)
+	if !reflect.DeepEqual(status, obj.Status) {
+		if _, err := c.Client.SetStatus(ctx, obj, status); err != nil && !c.statusDropped(err) {
+			return fmt.Errorf("updating status: %v", err)
+		}
+	}
+	return registerErr
+}
+
+// statusDropped reports whether err is ErrStatusNotSaved, which is logged
+// once rather than retried: the schemas are still registered, only not
+// reported.
+func (c *Controller) statusDropped(err error) bool {
+	if !errors.Is(err, ErrStatusNotSaved) {
+		return false
+	}
+	c.statusWarning.Do(func() { c.logf("%v; Jsonschema statuses will not be reported", err) })
+	return true
+}
+
+// register exports the schema and returns the status to record.
+func (c *Controller) register(obj *Jsonschema) (JsonschemaStatus, error) {
+	spec := obj.Spec
+	status := obj.Status
+	status.Conditions = append([]Condition(nil), obj.Status.Conditions...)
+	status.ObservedGeneration = obj.Metadata.Generation
+
+	schemaType, err := parseSchemaType(spec.SchemaType)
+	if err == nil && (spec.Name == "" || spec.Schema == "") {
+		err = fmt.Errorf("spec.name and spec.schema are required")
+	}
+	if err != nil {
+		c.setCondition(&status, "False", ReasonInvalidSpec, err.Error())
+		return status, nil
+	}
+
+	version, err := c.export(spec, schemaType)
+	if err != nil {
+		return c.registrationFailed(status, err)
+	}
+	schema, err := c.Registry.GetSchemaByVersion(spec.Name, version, spec.IsKey)
+	if err != nil {
+		return c.registrationFailed(status, err)
+	}
+	status.Subject = subject(spec)
+	status.IsKey = spec.IsKey
+	status.ID = schema.ID()
+	status.Version = version
+	c.setCondition(&status, "True", ReasonRegistered, fmt.Sprintf("registered as version %d with ID %d", version, schema.ID()))
+	return status, nil
+}
+
+// registrationFailed records err in the Ready condition, and returns it
+// only if it is retryable: a rejected schema, such as an incompatible or
+// invalid one, stays rejected until the spec changes.
+func (c *Controller) registrationFailed(status JsonschemaStatus, err error) (JsonschemaStatus, error) {
+	c.setCondition(&status, "False", ReasonRegistrationFailed, err.Error())
+	if !retryable(err) {
+		return status, nil
+	}
+	return status, err
+}
+
+// export registers the schema like ExportSchema, which only handles value
+// subjects without references.
+func (c *Controller) export(spec JsonschemaSpec, schemaType schema_registry_helper.SchemaType) (int, error) {
+	if spec.Compatibility != "" {
+		setter, ok := c.Registry.(compatibilitySetter)
+		if !ok {
+			return -1, fmt.Errorf("the registry cannot set compatibility levels")
+		}
+		if err := setter.SetCompatibility(spec.Name, spec.IsKey, spec.Compatibility); err != nil {
+			return -1, fmt.Errorf("setting compatibility: %w", err)
+		}
+	}
+	if !spec.IsKey && len(spec.References) == 0 {
+		return schema_registry_helper.ExportSchema([]byte(spec.Schema), spec.Name, schemaType, c.Registry)
+	}
+	resp, err := c.Registry.CheckSchema(spec.Name, spec.Schema, schemaType, spec.IsKey, spec.References...)
+	if err == nil {
+		return resp.Version, nil
+	}
+	if !strings.Contains(err.Error(), schema_registry_helper.ErrNotFound) {
+		return -1, err
+	}
+	schema, err := c.Registry.CreateSchema(spec.Name, spec.Schema, schemaType, spec.IsKey, spec.References...)
+	if err != nil {
+		return -1, err
+	}
+	return schema.Version(), nil
+}
+
+func (c *Controller) finalize(ctx context.Context, obj *Jsonschema) error {
+	if !obj.hasFinalizer() {
+		return nil
+	}
+	recorded := obj.Status
+	if recorded.Subject == "" && obj.Spec.Name != "" {
+		// Without a recorded status, as with a CRD that drops it, the
+		// subject is the one the spec names.
+		recorded.Subject = subject(obj.Spec)
+		recorded.IsKey = obj.Spec.IsKey
+	}
+	if obj.deleteSubject(c.DeleteSubjects) && recorded.Subject != "" {
+		deleter, ok := c.Registry.(subjectDeleter)
+		name, isKey := registeredName(recorded)
+		if !ok {
+			c.logf("%s: the registry cannot delete subjects; keeping %s", obj.Key(), recorded.Subject)
+		} else if _, err := deleter.DeleteSubject(name, isKey, false); err != nil &&
+			!strings.Contains(err.Error(), schema_registry_helper.ErrNotFound) {
+			if retryable(err) {
+				return fmt.Errorf("deleting subject %s: %v", recorded.Subject, err)
+			}
+			// The registry refused, e.g. because other schemas reference
+			// the subject; retrying would keep the resource forever.
+			message := fmt.Sprintf("keeping subject %s: %v", recorded.Subject, err)
+			c.logf("%s: %s", obj.Key(), message)
+			status := obj.Status
+			status.Conditions = append([]Condition(nil), obj.Status.Conditions...)
+			c.setCondition(&status, "False", ReasonDeletionFailed, message)
+			if updated, err := c.Client.SetStatus(ctx, obj, status); err == nil {
+				obj = updated
+			} else if !c.statusDropped(err) {
+				return fmt.Errorf("updating status: %v", err)
+			}
+		}
+	}
+	var finalizers []string
+	for _, f := range obj.Metadata.Finalizers {
+		if f != Finalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	if _, err := c.Client.SetFinalizers(ctx, obj, finalizers); err != nil && !IsNotFound(err) {
+		return fmt.Errorf("removing finalizer: %v", err)
+	}
+	return nil
+}
+
+// retryable reports whether a registry error may go away by itself: a
+// transport error or a 5xx response. Other responses, such as 409 for an
+// incompatible schema or 42206 for a subject that is still referenced,
+// are permanent.
+func retryable(err error) bool {
+	var registryError *schema_registry_helper.RegistryError
+	if errors.As(err, &registryError) {
+		return registryError.StatusCode >= 500
+	}
+	return true
+}
+
+// setCondition sets the Ready condition, keeping its transition time if
+// its status is unchanged.
+func (c *Controller) setCondition(status *JsonschemaStatus, conditionStatus, reason, message string) {
+	condition := status.condition(ConditionReady)
+	if condition == nil {
+		status.Conditions = append(status.Conditions, Condition{Type: ConditionReady})
+		condition = &status.Conditions[len(status.Conditions)-1]
+	}
+	if condition.Status != conditionStatus || condition.LastTransitionTime == "" {
+		condition.LastTransitionTime = c.timestamp()
+	}
+	condition.Status = conditionStatus
+	condition.Reason = reason
+	condition.Message = message
+}
+
+func parseSchemaType(s string) (schema_registry_helper.SchemaType, error) {
+	switch schemaType := schema_registry_helper.SchemaType(s); schemaType {
+	case "":
+		return schema_registry_helper.Json, nil
+	case schema_registry_helper.Json, schema_registry_helper.Avro, schema_registry_helper.Protobuf:
+		return schemaType, nil
+	}
+	return "", fmt.Errorf("unknown schemaType %q", s)
+}
+
+// subject is the subject the schema is registered under, without any
+// context the registry client adds.
+func subject(spec JsonschemaSpec) string {
+	if spec.IsKey {
+		return spec.Name + "-key"
+	}
+	return spec.Name + "-value"
+}
+
+// registeredName returns the name and key flag of the subject recorded in
+// status. Statuses written before IsKey was recorded are told apart by the
+// subject's suffix.
+func registeredName(status JsonschemaStatus) (string, bool) {
+	isKey := status.IsKey || strings.HasSuffix(status.Subject, "-key")
+	if isKey {
+		return strings.TrimSuffix(status.Subject, "-key"), true
+	}
+	return strings.TrimSuffix(status.Subject, "-value"), false
+}
@@ -0,0 +1,380 @@
+package jsonschema_controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infobloxopen/schema-registry-helper/schema_registry_helper"
+)
+
+const (
+	schemaV1 = `{"type":"object","properties":{"id":{"type":"string"}}}`
+	schemaV2 = `{"type":"object","properties":{"id":{"type":"string"},"name":{"type":"string"}}}`
+)
+
+func newJsonschema(name, schema string) *Jsonschema {
+	return &Jsonschema{
+		APIVersion: "schemaregistry.infoblox.com/v1",
+		Kind:       "Jsonschema",
+		Metadata:   ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       JsonschemaSpec{Name: name, Schema: schema},
+	}
+}
+
+func newController(client Client, registry schema_registry_helper.SchemaRegistry) *Controller {
+	return &Controller{
+		Client:     client,
+		Registry:   registry,
+		RetryDelay: 10 * time.Millisecond,
+		Logf:       func(string, ...interface{}) {},
+		now:        func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) },
+	}
+}
+
+func reconcile(t *testing.T, controller *Controller, client *FakeClient, name string) *Jsonschema {
+	t.Helper()
+	if err := controller.Reconcile(context.Background(), client.Get("default", name)); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	return client.Get("default", name)
+}
+
+func expectReady(t *testing.T, obj *Jsonschema, status, reason string) {
+	t.Helper()
+	ready := obj.Status.condition(ConditionReady)
+	if ready == nil {
+		t.Fatalf("no Ready condition in %+v", obj.Status)
+	}
+	if ready.Status != status || ready.Reason != reason {
+		t.Errorf("expected Ready %s/%s, got %s/%s: %s", status, reason, ready.Status, ready.Reason, ready.Message)
+	}
+}
+
+func TestReconcileRegisters(t *testing.T) {
+	client := NewFakeClient(newJsonschema("topic", schemaV1))
+	registry := schema_registry_helper.NewMemorySchemaRegistry()
+	controller := newController(client, registry)
+
+	obj := reconcile(t, controller, client, "topic")
+	if !obj.hasFinalizer() {
+		t.Errorf("expected finalizer, got %v", obj.Metadata.Finalizers)
+	}
+	schema, err := registry.GetLatestSchema("topic", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Status.Subject != "topic-value" || obj.Status.ID != schema.ID() || obj.Status.Version != 1 || obj.Status.ObservedGeneration != 1 {
+		t.Errorf("unexpected status %+v", obj.Status)
+	}
+	expectReady(t, obj, "True", ReasonRegistered)
+
+	// Nothing changed, so nothing is written.
+	resourceVersion := obj.Metadata.ResourceVersion
+	obj = reconcile(t, controller, client, "topic")
+	if obj.Metadata.ResourceVersion != resourceVersion {
+		t.Errorf("expected no update, resource version went from %s to %s", resourceVersion, obj.Metadata.ResourceVersion)
+	}
+
+	// A new schema is registered as a new version.
+	obj.Spec.Schema = schemaV2
+	client.Update(obj)
+	controller.now = func() time.Time { return time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC) }
+	obj = reconcile(t, controller, client, "topic")
+	if obj.Status.Version != 2 || obj.Status.ObservedGeneration != 2 {
+		t.Errorf("unexpected status %+v", obj.Status)
+	}
+	if ready := obj.Status.condition(ConditionReady); ready.LastTransitionTime != "2024-01-02T03:04:05Z" {
+		t.Errorf("expected the transition time to be kept, got %s", ready.LastTransitionTime)
+	}
+}
+
+func TestReconcileKeyWithCompatibility(t *testing.T) {
+	obj := newJsonschema("topic", schemaV1)
+	obj.Spec.IsKey = true
+	obj.Spec.Compatibility = schema_registry_helper.CompatibilityFull
+	client := NewFakeClient(obj)
+	registry := schema_registry_helper.NewMemorySchemaRegistry()
+	controller := newController(client, registry)
+
+	obj = reconcile(t, controller, client, "topic")
+	if obj.Status.Subject != "topic-key" || obj.Status.Version != 1 {
+		t.Errorf("unexpected status %+v", obj.Status)
+	}
+	if _, err := registry.GetLatestSchema("topic", true); err != nil {
+		t.Error(err)
+	}
+	if level, _ := registry.GetCompatibility("topic", true); level != schema_registry_helper.CompatibilityFull {
+		t.Errorf("expected FULL compatibility, got %s", level)
+	}
+}
+
+func TestReconcileInvalidSpec(t *testing.T) {
+	obj := newJsonschema("topic", schemaV1)
+	obj.Spec.SchemaType = "XML"
+	client := NewFakeClient(obj, newJsonschema("empty", ""))
+	controller := newController(client, schema_registry_helper.NewMemorySchemaRegistry())
+
+	obj = reconcile(t, controller, client, "topic")
+	expectReady(t, obj, "False", ReasonInvalidSpec)
+	if ready := obj.Status.condition(ConditionReady); !strings.Contains(ready.Message, `"XML"`) {
+		t.Errorf("unexpected message %q", ready.Message)
+	}
+	obj = reconcile(t, controller, client, "empty")
+	expectReady(t, obj, "False", ReasonInvalidSpec)
+}
+
+func TestReconcileRegistrationFailed(t *testing.T) {
+	obj := newJsonschema("topic", schemaV1)
+	obj.Spec.References = []schema_registry_helper.Reference{{Name: "other.json", Subject: "other-value", Version: 1}}
+	client := NewFakeClient(obj)
+	controller := newController(client, schema_registry_helper.NewMemorySchemaRegistry())
+
+	if err := controller.Reconcile(context.Background(), client.Get("default", "topic")); err == nil {
+		t.Fatal("expected an error for a missing reference")
+	}
+	obj = client.Get("default", "topic")
+	expectReady(t, obj, "False", ReasonRegistrationFailed)
+	if obj.Status.ObservedGeneration != 1 {
+		t.Errorf("unexpected status %+v", obj.Status)
+	}
+}
+
+// rejectingRegistry is a registry that rejects new schemas with err.
+type rejectingRegistry struct {
+	*schema_registry_helper.MemorySchemaRegistry
+	err error
+}
+
+func (r rejectingRegistry) CreateSchemaWithRules(subject, schema string, schemaType schema_registry_helper.SchemaType, isKey bool,
+	metadata *schema_registry_helper.Metadata, ruleSet *schema_registry_helper.RuleSet, references ...schema_registry_helper.Reference) (*schema_registry_helper.Schema, error) {
+	return nil, r.err
+}
+
+func TestReconcileIncompatible(t *testing.T) {
+	client := NewFakeClient(newJsonschema("topic", schemaV1))
+	registry := rejectingRegistry{
+		MemorySchemaRegistry: schema_registry_helper.NewMemorySchemaRegistry(),
+		err: &schema_registry_helper.RegistryError{
+			StatusCode: 409,
+			Status:     "409 Conflict",
+			ErrorCode:  schema_registry_helper.ErrorCodeIncompatibleSchema,
+			Message:    "Schema being registered is incompatible with an earlier schema",
+		},
+	}
+	controller := newController(client, registry)
+
+	// The rejection is reported, not retried.
+	obj := reconcile(t, controller, client, "topic")
+	expectReady(t, obj, "False", ReasonRegistrationFailed)
+	if ready := obj.Status.condition(ConditionReady); !strings.Contains(ready.Message, "incompatible") {
+		t.Errorf("unexpected message %q", ready.Message)
+	}
+	if obj.Status.ObservedGeneration != 1 {
+		t.Errorf("unexpected status %+v", obj.Status)
+	}
+
+	// A server error is retried.
+	registry.err = &schema_registry_helper.RegistryError{StatusCode: 500, Status: "500 Internal Server Error"}
+	controller.Registry = registry
+	if err := controller.Reconcile(context.Background(), client.Get("default", "topic")); err == nil {
+		t.Error("expected an error for a 500")
+	}
+}
+
+func TestReconcileDelete(t *testing.T) {
+	annotated := newJsonschema("annotated", schemaV1)
+	annotated.Metadata.Annotations = map[string]string{DeleteSubjectAnnotation: "true"}
+	optedOut := newJsonschema("opted-out", schemaV1)
+	optedOut.Metadata.Annotations = map[string]string{DeleteSubjectAnnotation: "false"}
+	client := NewFakeClient(newJsonschema("topic", schemaV1), newJsonschema("kept", schemaV1), annotated, optedOut)
+	registry := schema_registry_helper.NewMemorySchemaRegistry()
+	controller := newController(client, registry)
+	for _, name := range []string{"topic", "kept", "annotated", "opted-out"} {
+		reconcile(t, controller, client, name)
+	}
+
+	// Subjects are kept by default, unless the annotation asks otherwise.
+	for _, name := range []string{"kept", "annotated"} {
+		client.Delete("default", name)
+		if obj := reconcile(t, controller, client, name); obj != nil {
+			t.Errorf("expected %s to be deleted, got %+v", name, obj)
+		}
+	}
+	if _, err := registry.GetLatestSchema("kept", false); err != nil {
+		t.Errorf("expected the subject to be kept: %v", err)
+	}
+	if _, err := registry.GetLatestSchema("annotated", false); err == nil {
+		t.Error("expected the annotated subject to be deleted")
+	}
+
+	controller.DeleteSubjects = true
+
+	// The subject recorded in the status is deleted, not the one the
+	// spec names now.
+	obj := client.Get("default", "topic")
+	obj.Spec.Name = "renamed"
+	obj.Spec.IsKey = true
+	client.Update(obj)
+	client.Delete("default", "topic")
+	if obj := reconcile(t, controller, client, "topic"); obj != nil {
+		t.Errorf("expected topic to be deleted, got %+v", obj)
+	}
+	if _, err := registry.GetLatestSchema("topic", false); err == nil {
+		t.Error("expected the subject to be deleted")
+	}
+
+	client.Delete("default", "opted-out")
+	if obj := reconcile(t, controller, client, "opted-out"); obj != nil {
+		t.Errorf("expected opted-out to be deleted, got %+v", obj)
+	}
+	if _, err := registry.GetLatestSchema("opted-out", false); err != nil {
+		t.Errorf("expected the opted-out subject to be kept: %v", err)
+	}
+}
+
+// failingDeleter is a registry whose DeleteSubject fails with err.
+type failingDeleter struct {
+	*schema_registry_helper.MemorySchemaRegistry
+	err error
+}
+
+func (r failingDeleter) DeleteSubject(subject string, isKey bool, permanent bool) ([]int, error) {
+	return nil, r.err
+}
+
+func TestReconcileDeleteRefused(t *testing.T) {
+	obj := newJsonschema("topic", schemaV1)
+	obj.Metadata.Finalizers = []string{"example.com/other"}
+	client := NewFakeClient(obj)
+	registry := failingDeleter{MemorySchemaRegistry: schema_registry_helper.NewMemorySchemaRegistry()}
+	controller := newController(client, registry)
+	controller.DeleteSubjects = true
+	reconcile(t, controller, client, "topic")
+	client.Delete("default", "topic")
+
+	// A server error is retried with the finalizer in place.
+	registry.err = &schema_registry_helper.RegistryError{StatusCode: 503, Status: "503 Service Unavailable"}
+	controller.Registry = registry
+	if err := controller.Reconcile(context.Background(), client.Get("default", "topic")); err == nil {
+		t.Fatal("expected an error for a 503")
+	}
+	if obj := client.Get("default", "topic"); !obj.hasFinalizer() {
+		t.Errorf("expected the finalizer to be kept, got %v", obj.Metadata.Finalizers)
+	}
+
+	// A referenced subject cannot be deleted, so it is kept and the
+	// finalizer removed.
+	registry.err = &schema_registry_helper.RegistryError{
+		StatusCode: 422,
+		Status:     "422 Unprocessable Entity",
+		ErrorCode:  schema_registry_helper.ErrorCodeReferenceExists,
+		Message:    "One or more references exist to the schema {subject=topic-value,version=1}.",
+	}
+	controller.Registry = registry
+	obj = reconcile(t, controller, client, "topic")
+	if obj.hasFinalizer() {
+		t.Errorf("expected the finalizer to be removed, got %v", obj.Metadata.Finalizers)
+	}
+	expectReady(t, obj, "False", ReasonDeletionFailed)
+	if ready := obj.Status.condition(ConditionReady); !strings.Contains(ready.Message, "422") {
+		t.Errorf("unexpected message %q", ready.Message)
+	}
+	if _, err := registry.GetLatestSchema("topic", false); err != nil {
+		t.Errorf("expected the subject to be kept: %v", err)
+	}
+}
+
+func TestReconcileStatusDropped(t *testing.T) {
+	client := NewFakeClient(newJsonschema("topic", schemaV1))
+	client.DropStatus = true
+	registry := schema_registry_helper.NewMemorySchemaRegistry()
+	controller := newController(client, registry)
+	var logs []string
+	controller.Logf = func(format string, args ...interface{}) { logs = append(logs, fmt.Sprintf(format, args...)) }
+
+	// The schema is registered and the missing status logged once.
+	for i := 0; i < 2; i++ {
+		reconcile(t, controller, client, "topic")
+	}
+	if _, err := registry.GetLatestSchema("topic", false); err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || !strings.Contains(logs[0], "status option") {
+		t.Errorf("expected one warning, got %q", logs)
+	}
+
+	// Without a status, the spec's subject is deleted.
+	controller.DeleteSubjects = true
+	client.Delete("default", "topic")
+	if obj := reconcile(t, controller, client, "topic"); obj != nil {
+		t.Errorf("expected topic to be deleted, got %+v", obj)
+	}
+	if _, err := registry.GetLatestSchema("topic", false); err == nil {
+		t.Error("expected the subject to be deleted")
+	}
+}
+
+func TestReconcileConflict(t *testing.T) {
+	client := NewFakeClient(newJsonschema("topic", schemaV1))
+	controller := newController(client, schema_registry_helper.NewMemorySchemaRegistry())
+
+	stale := client.Get("default", "topic")
+	client.Update(stale)
+	err := controller.Reconcile(context.Background(), stale)
+	if err == nil || !strings.Contains(err.Error(), "409") {
+		t.Errorf("expected a conflict, got %v", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	client := NewFakeClient(newJsonschema("existing", schemaV1))
+	registry := schema_registry_helper.NewMemorySchemaRegistry()
+	controller := newController(client, registry)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		controller.Run(ctx)
+		close(done)
+	}()
+
+	waitFor(t, "existing to be registered", func() bool {
+		obj := client.Get("default", "existing")
+		return obj.Status.Version == 1
+	})
+	client.Create(newJsonschema("added", schemaV1))
+	waitFor(t, "added to be registered", func() bool {
+		obj := client.Get("default", "added")
+		return obj.Status.Version == 1
+	})
+	obj := client.Get("default", "added")
+	obj.Spec.Schema = schemaV2
+	client.Update(obj)
+	waitFor(t, "added to be updated", func() bool {
+		obj := client.Get("default", "added")
+		return obj.Status.Version == 2
+	})
+	client.Delete("default", "existing")
+	waitFor(t, "existing to be deleted", func() bool {
+		return client.Get("default", "existing") == nil
+	})
+	if _, err := registry.GetLatestSchema("existing", false); err != nil {
+		t.Errorf("expected the subject to be kept: %v", err)
+	}
+
+	cancel()
+	<-done
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
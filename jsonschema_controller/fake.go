@@ -0,0 +1,212 @@
+package jsonschema_controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// FakeClient is an in-memory Client that behaves like the API server for
+// the requests the controller makes: resource versions are checked on
+// finalizer updates, generations count spec changes, and deleting a
+// resource with finalizers only marks it until they are removed. It also
+// has Create, Update, Delete and Get for tests to act as users.
+type FakeClient struct {
+	// DropStatus makes SetStatus fail as RESTClient does when the CRD has
+	// no status schema.
+	DropStatus bool
+
+	lock    sync.Mutex
+	version int
+	objects map[string]*Jsonschema
+	events  []fakeEvent
+	// changed is closed and replaced whenever an event is added.
+	changed chan struct{}
+}
+
+type fakeEvent struct {
+	version   int
+	eventType string
+	obj       Jsonschema
+}
+
+var _ Client = (*FakeClient)(nil)
+
+// NewFakeClient returns a FakeClient holding objs.
+func NewFakeClient(objs ...*Jsonschema) *FakeClient {
+	c := &FakeClient{objects: make(map[string]*Jsonschema), changed: make(chan struct{})}
+	for _, obj := range objs {
+		c.Create(obj)
+	}
+	return c
+}
+
+// record stores obj under a new resource version and adds an event for
+// it. The lock must be held.
+func (c *FakeClient) record(eventType string, obj *Jsonschema) *Jsonschema {
+	c.version++
+	obj.Metadata.ResourceVersion = strconv.Itoa(c.version)
+	if eventType == Deleted {
+		delete(c.objects, obj.Key())
+	} else {
+		c.objects[obj.Key()] = obj
+	}
+	c.events = append(c.events, fakeEvent{version: c.version, eventType: eventType, obj: copyObject(obj)})
+	close(c.changed)
+	c.changed = make(chan struct{})
+	result := copyObject(obj)
+	return &result
+}
+
+// copyObject returns a deep copy, so that callers cannot change the
+// stored objects.
+func copyObject(obj *Jsonschema) Jsonschema {
+	var result Jsonschema
+	bs, _ := json.Marshal(obj)
+	json.Unmarshal(bs, &result)
+	return result
+}
+
+// Create adds obj at generation 1.
+func (c *FakeClient) Create(obj *Jsonschema) *Jsonschema {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	stored := copyObject(obj)
+	stored.Metadata.Generation = 1
+	return c.record(Added, &stored)
+}
+
+// Update replaces the spec of an existing object, increasing its
+// generation if the spec changed. It returns nil if there is no such
+// object.
+func (c *FakeClient) Update(obj *Jsonschema) *Jsonschema {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	existing, ok := c.objects[obj.Key()]
+	if !ok {
+		return nil
+	}
+	stored := copyObject(existing)
+	if !reflect.DeepEqual(stored.Spec, obj.Spec) {
+		stored.Spec = copyObject(obj).Spec
+		stored.Metadata.Generation++
+	}
+	return c.record(Modified, &stored)
+}
+
+// Delete deletes an object, or only sets its deletion timestamp if it has
+// finalizers. It reports whether the object existed.
+func (c *FakeClient) Delete(namespace, name string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	existing, ok := c.objects[namespace+"/"+name]
+	if !ok {
+		return false
+	}
+	stored := copyObject(existing)
+	if len(stored.Metadata.Finalizers) == 0 {
+		c.record(Deleted, &stored)
+		return true
+	}
+	if stored.Metadata.DeletionTimestamp == nil {
+		now := time.Now().UTC().Format(time.RFC3339)
+		stored.Metadata.DeletionTimestamp = &now
+		c.record(Modified, &stored)
+	}
+	return true
+}
+
+// Get returns a copy of an object, or nil.
+func (c *FakeClient) Get(namespace, name string) *Jsonschema {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	existing, ok := c.objects[namespace+"/"+name]
+	if !ok {
+		return nil
+	}
+	result := copyObject(existing)
+	return &result
+}
+
+func (c *FakeClient) List(ctx context.Context) (*JsonschemaList, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	list := &JsonschemaList{}
+	list.Metadata.ResourceVersion = strconv.Itoa(c.version)
+	keys := make([]string, 0, len(c.objects))
+	for key := range c.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		list.Items = append(list.Items, copyObject(c.objects[key]))
+	}
+	return list, nil
+}
+
+func (c *FakeClient) Watch(ctx context.Context, resourceVersion string, handle func(eventType string, obj *Jsonschema)) error {
+	from, err := strconv.Atoi(resourceVersion)
+	if err != nil {
+		return &APIError{Code: 400, Reason: "BadRequest", Message: "invalid resourceVersion " + strconv.Quote(resourceVersion)}
+	}
+	for {
+		c.lock.Lock()
+		var pending []fakeEvent
+		for _, event := range c.events {
+			if event.version > from {
+				pending = append(pending, event)
+			}
+		}
+		changed := c.changed
+		c.lock.Unlock()
+
+		for _, event := range pending {
+			obj := event.obj
+			handle(event.eventType, &obj)
+			from = event.version
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		}
+	}
+}
+
+func (c *FakeClient) SetFinalizers(ctx context.Context, obj *Jsonschema, finalizers []string) (*Jsonschema, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	existing, ok := c.objects[obj.Key()]
+	if !ok {
+		return nil, &APIError{Code: 404, Reason: "NotFound", Message: obj.Key() + " not found"}
+	}
+	if existing.Metadata.ResourceVersion != obj.Metadata.ResourceVersion {
+		return nil, &APIError{Code: 409, Reason: "Conflict", Message: "the object has been modified"}
+	}
+	stored := copyObject(existing)
+	stored.Metadata.Finalizers = append([]string(nil), finalizers...)
+	if stored.Metadata.DeletionTimestamp != nil && len(finalizers) == 0 {
+		return c.record(Deleted, &stored), nil
+	}
+	return c.record(Modified, &stored), nil
+}
+
+func (c *FakeClient) SetStatus(ctx context.Context, obj *Jsonschema, status JsonschemaStatus) (*Jsonschema, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	existing, ok := c.objects[obj.Key()]
+	if !ok {
+		return nil, &APIError{Code: 404, Reason: "NotFound", Message: obj.Key() + " not found"}
+	}
+	if c.DropStatus {
+		return nil, fmt.Errorf("%s: %w", obj.Key(), ErrStatusNotSaved)
+	}
+	stored := copyObject(existing)
+	stored.Status = status
+	return c.record(Modified, &stored), nil
+}
@@ -0,0 +1,173 @@
+// Package jsonschema_controller is a Kubernetes controller for the
+// Jsonschema custom resources that schema_to_cr generates. It registers
+// spec.schema under spec.name with ExportSchema, records the registered
+// subject, ID and version in the status, and uses a finalizer to delete
+// the subject, if asked to, when the resource is deleted.
+//
+// It talks to the Kubernetes API through the small Client interface.
+// RESTClient implements it over HTTP, and FakeClient in memory for tests,
+// together with MemorySchemaRegistry as the registry.
+package jsonschema_controller
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/infobloxopen/schema-registry-helper/schema_registry_helper"
+)
+
+// Finalizer is added to every Jsonschema the controller registers, so that
+// it can remove the subject before the resource goes away.
+const Finalizer = "schemaregistry.infoblox.com/finalizer"
+
+// DeleteSubjectAnnotation set to "true" on a Jsonschema has its subject
+// soft-deleted with it, and set to "false" keeps the subject even if the
+// controller deletes subjects by default.
+const DeleteSubjectAnnotation = "schemaregistry.infoblox.com/delete-subject"
+
+// Condition types and reasons written to the status.
+const (
+	ConditionReady = "Ready"
+
+	ReasonRegistered         = "Registered"
+	ReasonInvalidSpec        = "InvalidSpec"
+	ReasonRegistrationFailed = "RegistrationFailed"
+	ReasonDeletionFailed     = "DeletionFailed"
+)
+
+// Jsonschema is the custom resource defined by the generated CRD.
+type Jsonschema struct {
+	APIVersion string           `json:"apiVersion,omitempty"`
+	Kind       string           `json:"kind,omitempty"`
+	Metadata   ObjectMeta       `json:"metadata"`
+	Spec       JsonschemaSpec   `json:"spec"`
+	Status     JsonschemaStatus `json:"status,omitempty"`
+}
+
+// ObjectMeta holds the metadata fields the controller uses. Changes are
+// sent as merge patches, so fields not listed here are left untouched.
+type ObjectMeta struct {
+	Name              string            `json:"name"`
+	Namespace         string            `json:"namespace,omitempty"`
+	ResourceVersion   string            `json:"resourceVersion,omitempty"`
+	Generation        int64             `json:"generation,omitempty"`
+	DeletionTimestamp *string           `json:"deletionTimestamp,omitempty"`
+	Finalizers        []string          `json:"finalizers,omitempty"`
+	Annotations       map[string]string `json:"annotations,omitempty"`
+}
+
+// JsonschemaSpec is what the resource asks to be registered.
+type JsonschemaSpec struct {
+	// Name is the topic; the schema is registered under its -value
+	// subject, or its -key subject if IsKey is set.
+	Name       string                             `json:"name"`
+	Schema     string                             `json:"schema"`
+	SchemaType string                             `json:"schemaType,omitempty"`
+	IsKey      bool                               `json:"isKey,omitempty"`
+	References []schema_registry_helper.Reference `json:"references,omitempty"`
+	// Compatibility, when set, is set on the subject before registering.
+	Compatibility string `json:"compatibility,omitempty"`
+}
+
+// JsonschemaStatus is what the controller registered.
+type JsonschemaStatus struct {
+	// Subject and IsKey are what is deleted with the resource, even if the
+	// spec has changed since.
+	Subject            string      `json:"subject,omitempty"`
+	IsKey              bool        `json:"isKey,omitempty"`
+	ID                 int         `json:"id,omitempty"`
+	Version            int         `json:"version,omitempty"`
+	ObservedGeneration int64       `json:"observedGeneration,omitempty"`
+	Conditions         []Condition `json:"conditions,omitempty"`
+}
+
+// Condition follows the Kubernetes condition conventions.
+type Condition struct {
+	Type               string `json:"type"`
+	Status             string `json:"status"`
+	Reason             string `json:"reason,omitempty"`
+	Message            string `json:"message,omitempty"`
+	LastTransitionTime string `json:"lastTransitionTime,omitempty"`
+}
+
+// JsonschemaList is the response to a list request.
+type JsonschemaList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+	Items []Jsonschema `json:"items"`
+}
+
+// Watch event types.
+const (
+	Added    = "ADDED"
+	Modified = "MODIFIED"
+	Deleted  = "DELETED"
+	Error    = "ERROR"
+)
+
+// watchEvent is a line of a watch response.
+type watchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// Key identifies a Jsonschema as namespace/name.
+func (obj *Jsonschema) Key() string {
+	return obj.Metadata.Namespace + "/" + obj.Metadata.Name
+}
+
+// deleteSubject reports whether the subject of obj is deleted with it,
+// given the controller's default.
+func (obj *Jsonschema) deleteSubject(byDefault bool) bool {
+	switch obj.Metadata.Annotations[DeleteSubjectAnnotation] {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return byDefault
+}
+
+func (obj *Jsonschema) hasFinalizer() bool {
+	for _, f := range obj.Metadata.Finalizers {
+		if f == Finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// condition returns the condition of the given type, or nil.
+func (status *JsonschemaStatus) condition(conditionType string) *Condition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == conditionType {
+			return &status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// APIError is an error response from the Kubernetes API.
+type APIError struct {
+	Code    int    `json:"code"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Code, e.Reason, e.Message)
+}
+
+// IsNotFound reports whether err is a 404 from the Kubernetes API.
+func IsNotFound(err error) bool {
+	apiError, ok := err.(*APIError)
+	return ok && apiError.Code == 404
+}
+
+// IsConflict reports whether err is a 409 from the Kubernetes API, such as
+// an update of an outdated resource version.
+func IsConflict(err error) bool {
+	apiError, ok := err.(*APIError)
+	return ok && apiError.Code == 409
+}
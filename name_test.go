@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+var testResourceNames = []struct {
+	schemaName  string
+	crNamespace string
+	want        string
+}{
+	{schemaName: "dev-pb-Event", crNamespace: "dev", want: "dev-pb-event"},
+	{schemaName: "{{ .Release.Namespace }}-pb-Event", crNamespace: "{{ .Release.Namespace }}", want: "{{ .Release.Namespace }}-pb-event"},
+	{schemaName: "dev-pb-Event_Type", crNamespace: "dev", want: "dev-pb-event-type"},
+	{schemaName: "_dev..pb-.Event_", crNamespace: "dev", want: "dev.pb.event"},
+	{schemaName: "atlas.tagging.TagEvent.v1", crNamespace: "dev", want: "atlas.tagging.tagevent.v1"},
+	{schemaName: "{{ .Release.Namespace }}.Event", crNamespace: "{{ .Release.Namespace }}", want: "{{ .Release.Namespace }}.event"},
+}
+
+func TestResourceName(t *testing.T) {
+	for _, tc := range testResourceNames {
+		got, err := resourceName(tc.schemaName, tc.crNamespace)
+		if err != nil || got != tc.want {
+			t.Errorf("%q: got %q %v, wanted %q", tc.schemaName, got, err, tc.want)
+		}
+	}
+}
+
+func TestResourceNameTruncated(t *testing.T) {
+	long := strings.Repeat("Event", 60)
+	a, err := resourceName("dev-pb-"+long+"A", "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := resourceName("dev-pb-"+long+"B", "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != maxResourceName || a == b || !strings.HasPrefix(a, "dev-pb-event") {
+		t.Errorf("got %q (%d) and %q", a, len(a), b)
+	}
+
+	helm := "{{ .Release.Namespace }}"
+	c, err := resourceName(helm+"-pb-"+long, helm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered := strings.ReplaceAll(c, helm, strings.Repeat("n", maxNamespaceName)); len(rendered) != maxResourceName || !strings.HasPrefix(c, helm+"-pb-") {
+		t.Errorf("got %q (%d when rendered)", c, len(rendered))
+	}
+}
+
+func TestResourceNameInvalid(t *testing.T) {
+	if name, err := resourceName("___", "dev"); err == nil {
+		t.Errorf("got %q", name)
+	}
+}
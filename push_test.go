@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/infobloxopen/schema-registry-helper/schema_registry_helper"
+)
+
+func TestPushSchemas(t *testing.T) {
+	registry := schema_registry_helper.NewMemorySchemaRegistry()
+	cfg := defaultConfig()
+	cfg.Inputs = []string{"example/schema"}
+	cfg.CRNamespace = "dev"
+	cfg.Omit = []string{"summary"}
+
+	if err := pushSchemas(cfg, registry, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.GetLatestSchema("dev-pb-Event", false); err == nil {
+		t.Error("dry run registered a schema")
+	}
+
+	if err := pushSchemas(cfg, registry, false); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := registry.GetLatestSchema("dev-pb-Event", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.Version() != 1 {
+		t.Errorf("got version %d, wanted 1", schema.Version())
+	}
+	if _, err := registry.GetLatestSchema("dev-pb-Summary", false); err == nil {
+		t.Error("omitted schema was registered")
+	}
+
+	// Pushing again finds the registered versions.
+	if err := pushSchemas(cfg, registry, false); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := registry.GetSchemaVersions("dev-pb-Event", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 {
+		t.Errorf("got versions %v after pushing twice", versions)
+	}
+}
@@ -0,0 +1,215 @@
+package schema_registry_helper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	allSubjects   = "/subjects"
+	subjectDelete = "/subjects/%s"
+	versionDelete = "/subjects/%s/versions/%d"
+	globalConfig  = "/config"
+	subjectConfig = "/config/%s"
+	globalMode    = "/mode"
+	subjectMode   = "/mode/%s"
+)
+
+// Error codes returned by Schema Registry in RegistryError.ErrorCode.
+const (
+	ErrorCodeSubjectNotFound       = 40401
+	ErrorCodeVersionNotFound       = 40402
+	ErrorCodeSchemaNotFound        = 40403
+	ErrorCodeSubjectSoftDeleted    = 40404
+	ErrorCodeSubjectNotSoftDeleted = 40405
+	ErrorCodeIncompatibleSchema    = 409
+	ErrorCodeInvalidSchema         = 42201
+	ErrorCodeReferenceExists       = 42206
+)
+
+// Compatibility levels accepted by SetCompatibility.
+const (
+	CompatibilityNone               = "NONE"
+	CompatibilityBackward           = "BACKWARD"
+	CompatibilityBackwardTransitive = "BACKWARD_TRANSITIVE"
+	CompatibilityForward            = "FORWARD"
+	CompatibilityForwardTransitive  = "FORWARD_TRANSITIVE"
+	CompatibilityFull               = "FULL"
+	CompatibilityFullTransitive     = "FULL_TRANSITIVE"
+)
+
+// Modes accepted by SetMode.
+const (
+	ModeReadWrite = "READWRITE"
+	ModeReadOnly  = "READONLY"
+	ModeImport    = "IMPORT"
+)
+
+// GetSubjects lists the subjects in the client's context, with their
+// key/value suffix. Soft deleted subjects are included when deleted is set.
+func (client *SchemaRegistryClient) GetSubjects(deleted bool) ([]string, error) {
+	query := url.Values{}
+	if deleted {
+		query.Set("deleted", "true")
+	}
+	if client.schemaContext != "" {
+		query.Set("subjectPrefix", QualifiedSubject(client.schemaContext, ""))
+	}
+	uri := allSubjects
+	if len(query) > 0 {
+		uri += "?" + query.Encode()
+	}
+	resp, err := client.httpRequest("GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var subjects = []string{}
+	err = json.Unmarshal(resp, &subjects)
+	if err != nil {
+		return nil, err
+	}
+	if client.schemaContext != "" {
+		for i, subject := range subjects {
+			_, subjects[i] = SplitQualifiedSubject(subject)
+		}
+	}
+	return subjects, nil
+}
+
+// DeleteSubject deletes every version of a subject and returns their
+// numbers. A permanent delete only succeeds after a soft delete.
+func (client *SchemaRegistryClient) DeleteSubject(subject string, isKey bool, permanent bool) ([]int, error) {
+
+	concreteSubject := client.getConcreteSubject(subject, isKey)
+	uri := fmt.Sprintf(subjectDelete, url.PathEscape(concreteSubject))
+	if permanent {
+		uri += "?permanent=true"
+	}
+	resp, err := client.httpRequest("DELETE", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions = []int{}
+	err = json.Unmarshal(resp, &versions)
+	if err != nil {
+		return nil, err
+	}
+	client.invalidateSubject(concreteSubject)
+	return versions, nil
+}
+
+// DeleteSchemaVersion deletes a single version of a subject. A permanent
+// delete only succeeds after a soft delete.
+func (client *SchemaRegistryClient) DeleteSchemaVersion(subject string, version int, isKey bool, permanent bool) error {
+
+	concreteSubject := client.getConcreteSubject(subject, isKey)
+	uri := fmt.Sprintf(versionDelete, url.PathEscape(concreteSubject), version)
+	if permanent {
+		uri += "?permanent=true"
+	}
+	_, err := client.httpRequest("DELETE", uri, nil)
+	if err != nil {
+		return err
+	}
+	client.invalidateSubject(concreteSubject)
+	return nil
+}
+
+// GetCompatibility returns the compatibility level of a subject, falling
+// back to the global level if the subject has none of its own. An empty
+// subject returns the global level.
+func (client *SchemaRegistryClient) GetCompatibility(subject string, isKey bool) (string, error) {
+	var result struct {
+		CompatibilityLevel string `json:"compatibilityLevel"`
+	}
+	if err := client.getSetting(client.settingPath(globalConfig, subjectConfig, subject, isKey), &result); err != nil {
+		return "", err
+	}
+	return result.CompatibilityLevel, nil
+}
+
+// SetCompatibility sets the compatibility level of a subject, or the
+// global level if subject is empty.
+func (client *SchemaRegistryClient) SetCompatibility(subject string, isKey bool, level string) error {
+	payload := map[string]string{"compatibility": level}
+	return client.putSetting(client.settingPath(globalConfig, subjectConfig, subject, isKey), payload)
+}
+
+// GetMode returns the mode of a subject, falling back to the global mode
+// if the subject has none of its own. An empty subject returns the
+// global mode.
+func (client *SchemaRegistryClient) GetMode(subject string, isKey bool) (string, error) {
+	var result struct {
+		Mode string `json:"mode"`
+	}
+	if err := client.getSetting(client.settingPath(globalMode, subjectMode, subject, isKey), &result); err != nil {
+		return "", err
+	}
+	return result.Mode, nil
+}
+
+// SetMode sets the mode of a subject, or the global mode if subject is
+// empty.
+func (client *SchemaRegistryClient) SetMode(subject string, isKey bool, mode string) error {
+	payload := map[string]string{"mode": mode}
+	return client.putSetting(client.settingPath(globalMode, subjectMode, subject, isKey), payload)
+}
+
+// settingPath builds a /config or /mode path. The global setting of a
+// scoped client is the setting of its context.
+func (client *SchemaRegistryClient) settingPath(global, format, subject string, isKey bool) string {
+	if subject != "" {
+		return fmt.Sprintf(format, url.PathEscape(client.getConcreteSubject(subject, isKey)))
+	}
+	if client.schemaContext != "" {
+		return fmt.Sprintf(format, url.PathEscape(QualifiedSubject(client.schemaContext, "")))
+	}
+	return global
+}
+
+func (client *SchemaRegistryClient) getSetting(uri string, result interface{}) error {
+	resp, err := client.httpRequest("GET", uri+"?defaultToGlobal=true", nil)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(resp, result)
+}
+
+func (client *SchemaRegistryClient) putSetting(uri string, payload map[string]string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = client.httpRequest("PUT", uri, bytes.NewReader(body))
+	return err
+}
+
+// invalidateSubject drops the cached versions of a deleted subject, in
+// memory and on disk.
+func (client *SchemaRegistryClient) invalidateSubject(concreteSubject string) {
+	client.removeDiskSubject(concreteSubject)
+	if !client.cachingEnabled {
+		return
+	}
+	prefix := concreteSubject + "-"
+	evicted := 0
+	client.subjectSchemaCacheLock.Lock()
+	for key := range client.subjectSchemaCache {
+		if version := strings.TrimPrefix(key, prefix); version != key {
+			if _, err := strconv.Atoi(version); err == nil || version == "latest" {
+				delete(client.subjectSchemaCache, key)
+				evicted++
+			}
+		}
+	}
+	client.subjectSchemaCacheLock.Unlock()
+	if evicted > 0 {
+		client.instrumentation.CacheEvicted(SubjectSchemaCache, evicted)
+	}
+}
@@ -0,0 +1,65 @@
+package schema_registry_helper
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminRequests(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.EscapedPath()+"?"+r.URL.RawQuery+" "+string(body))
+		switch r.URL.Path {
+		case "/subjects":
+			json.NewEncoder(w).Encode([]string{":.tenant:users-value"})
+		case "/config/:.tenant:users-value":
+			json.NewEncoder(w).Encode(map[string]string{"compatibilityLevel": CompatibilityFull})
+		default:
+			json.NewEncoder(w).Encode([]int{1, 2})
+		}
+	}))
+	defer server.Close()
+
+	client := CreateSchemaRegistryClient(server.URL).WithContext("tenant")
+	subjects, err := client.GetSubjects(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subjects) != 1 || subjects[0] != "users-value" {
+		t.Errorf("got subjects %v", subjects)
+	}
+	level, err := client.GetCompatibility("users", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level != CompatibilityFull {
+		t.Errorf("got level %q", level)
+	}
+	if err := client.SetMode("", false, ModeReadOnly); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := client.DeleteSubject("users", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Errorf("got versions %v", versions)
+	}
+
+	expected := []string{
+		"GET /subjects?deleted=true&subjectPrefix=%3A.tenant%3A ",
+		"GET /config/:.tenant:users-value?defaultToGlobal=true ",
+		`PUT /mode/:.tenant:?` + ` {"mode":"READONLY"}`,
+		"DELETE /subjects/:.tenant:users-key?permanent=true ",
+	}
+	for i, r := range expected {
+		if i >= len(requests) || requests[i] != r {
+			t.Errorf("got requests %q, wanted %q", requests, expected)
+			break
+		}
+	}
+}
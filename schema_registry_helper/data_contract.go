@@ -0,0 +1,158 @@
+package schema_registry_helper
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Metadata is the data contract metadata attached to a schema version.
+// Tags map a field path to the tags applied to it, Properties hold
+// arbitrary key/value pairs, and Sensitive lists property names whose
+// values should not be shown.
+type Metadata struct {
+	Tags       map[string][]string `json:"tags,omitempty"`
+	Properties map[string]string   `json:"properties,omitempty"`
+	Sensitive  []string            `json:"sensitive,omitempty"`
+}
+
+// RuleSet holds the rules attached to a schema version. Domain rules
+// validate or transform messages of a single version, while migration
+// rules transform messages between versions.
+type RuleSet struct {
+	MigrationRules []Rule `json:"migrationRules,omitempty"`
+	DomainRules    []Rule `json:"domainRules,omitempty"`
+}
+
+// RuleKind is either a CONDITION, which must hold for a message to be
+// accepted, or a TRANSFORM, which may change the message.
+type RuleKind string
+
+// RuleMode controls when a rule runs. Domain rules use WRITE, READ and
+// WRITEREAD; migration rules use UPGRADE, DOWNGRADE and UPDOWN.
+type RuleMode string
+
+const (
+	ConditionRule RuleKind = "CONDITION"
+	TransformRule RuleKind = "TRANSFORM"
+
+	RuleModeWrite     RuleMode = "WRITE"
+	RuleModeRead      RuleMode = "READ"
+	RuleModeWriteRead RuleMode = "WRITEREAD"
+	RuleModeUpgrade   RuleMode = "UPGRADE"
+	RuleModeDowngrade RuleMode = "DOWNGRADE"
+	RuleModeUpDown    RuleMode = "UPDOWN"
+)
+
+// Rule is a single data contract rule. Type names the language of Expr,
+// such as "CEL" or "CEL_FIELD", and selects the RuleExecutor that runs it.
+type Rule struct {
+	Name      string            `json:"name"`
+	Doc       string            `json:"doc,omitempty"`
+	Kind      RuleKind          `json:"kind"`
+	Mode      RuleMode          `json:"mode"`
+	Type      string            `json:"type"`
+	Tags      []string          `json:"tags,omitempty"`
+	Params    map[string]string `json:"params,omitempty"`
+	Expr      string            `json:"expr,omitempty"`
+	OnSuccess string            `json:"onSuccess,omitempty"`
+	OnFailure string            `json:"onFailure,omitempty"`
+	Disabled  bool              `json:"disabled,omitempty"`
+}
+
+// RuleContext describes the rule being run and the message it runs on.
+type RuleContext struct {
+	Subject string
+	Schema  *Schema
+	Rule    Rule
+	Mode    RuleMode
+}
+
+// RuleExecutor runs rules of one type locally. For a CONDITION rule it
+// returns whether the message satisfies the rule as a bool; for a
+// TRANSFORM rule it returns the transformed message.
+type RuleExecutor interface {
+	Execute(ctx RuleContext, message interface{}) (interface{}, error)
+}
+
+// RuleExecutorFunc lets an ordinary function be used as a RuleExecutor.
+type RuleExecutorFunc func(ctx RuleContext, message interface{}) (interface{}, error)
+
+func (f RuleExecutorFunc) Execute(ctx RuleContext, message interface{}) (interface{}, error) {
+	return f(ctx, message)
+}
+
+// RuleExecutors maps a rule type, such as "CEL", to the executor that
+// runs rules of that type.
+type RuleExecutors map[string]RuleExecutor
+
+// RuleError reports a domain rule that failed or could not be run.
+type RuleError struct {
+	Subject string
+	Rule    Rule
+	Err     error
+}
+
+func (e *RuleError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("rule %s failed for subject %s", e.Rule.Name, e.Subject)
+	}
+	return fmt.Sprintf("rule %s failed for subject %s: %v", e.Rule.Name, e.Subject, e.Err)
+}
+
+func (e *RuleError) Unwrap() error {
+	return e.Err
+}
+
+// ExecuteDomainRules runs the domain rules of schema that apply to mode
+// (RuleModeWrite when serializing, RuleModeRead when deserializing) in
+// order, and returns the message produced by any TRANSFORM rules. A
+// failing rule returns a *RuleError unless its OnFailure action is
+// "NONE". Disabled rules are skipped, and a rule whose type has no
+// executor is treated as a failure.
+func (executors RuleExecutors) ExecuteDomainRules(subject string, schema *Schema, mode RuleMode,
+	message interface{}) (interface{}, error) {
+
+	if schema == nil || schema.ruleSet == nil {
+		return message, nil
+	}
+	for _, rule := range schema.ruleSet.DomainRules {
+		if rule.Disabled || !ruleApplies(rule.Mode, mode) {
+			continue
+		}
+		result, err := executors.executeRule(RuleContext{Subject: subject, Schema: schema, Rule: rule, Mode: mode}, message)
+		if err != nil {
+			if strings.EqualFold(rule.OnFailure, "NONE") {
+				continue
+			}
+			return nil, &RuleError{Subject: subject, Rule: rule, Err: err}
+		}
+		if rule.Kind != ConditionRule {
+			message = result
+		}
+	}
+	return message, nil
+}
+
+func (executors RuleExecutors) executeRule(ctx RuleContext, message interface{}) (interface{}, error) {
+	executor, ok := executors[ctx.Rule.Type]
+	if !ok {
+		return nil, fmt.Errorf("no executor for rule type %q", ctx.Rule.Type)
+	}
+	result, err := executor.Execute(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Rule.Kind == ConditionRule {
+		if ok, isBool := result.(bool); !isBool || !ok {
+			return nil, fmt.Errorf("condition %q not satisfied", ctx.Rule.Expr)
+		}
+	}
+	return result, nil
+}
+
+func ruleApplies(ruleMode, mode RuleMode) bool {
+	if ruleMode == mode {
+		return true
+	}
+	return ruleMode == RuleModeWriteRead && (mode == RuleModeWrite || mode == RuleModeRead)
+}
@@ -0,0 +1,48 @@
+package schema_registry_helper
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExecuteDomainRules(t *testing.T) {
+	registry := NewMemorySchemaRegistry()
+	ruleSet := &RuleSet{DomainRules: []Rule{
+		{Name: "upper", Kind: TransformRule, Mode: RuleModeWrite, Type: "TEST"},
+		{Name: "notEmpty", Kind: ConditionRule, Mode: RuleModeWriteRead, Type: "TEST", Expr: "message != ''"},
+		{Name: "disabled", Kind: ConditionRule, Mode: RuleModeWrite, Type: "MISSING", Disabled: true},
+	}}
+	metadata := &Metadata{Properties: map[string]string{"owner": "events"}}
+	if _, err := ExportSchemaWithRules([]byte(`{"type": "string"}`), "topic", Json, metadata, ruleSet, registry); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := registry.GetLatestSchemaWithMetadata("topic", map[string]string{"owner": "events"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.RuleSet() == nil || schema.Metadata().Properties["owner"] != "events" {
+		t.Fatalf("got metadata %v rules %v", schema.Metadata(), schema.RuleSet())
+	}
+
+	executors := RuleExecutors{"TEST": RuleExecutorFunc(func(ctx RuleContext, message interface{}) (interface{}, error) {
+		if ctx.Rule.Kind == TransformRule {
+			return strings.ToUpper(message.(string)), nil
+		}
+		return message.(string) != "", nil
+	})}
+
+	result, err := executors.ExecuteDomainRules("topic", schema, RuleModeWrite, "event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "EVENT" {
+		t.Errorf("got %v, wanted EVENT", result)
+	}
+
+	_, err = executors.ExecuteDomainRules("topic", schema, RuleModeRead, "")
+	var ruleErr *RuleError
+	if !errors.As(err, &ruleErr) || ruleErr.Rule.Name != "notEmpty" {
+		t.Errorf("got error %v, wanted notEmpty to fail", err)
+	}
+}
@@ -0,0 +1,184 @@
+package schema_registry_helper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// DiskCache is reported to Instrumentation for lookups in the persistent
+// cache.
+const DiskCache = "diskCache"
+
+// diskCache stores schemas as files so that a client can start without
+// the registry. Entries live under
+//
+//	<dir>/<context>/ids/<id>.json
+//	<dir>/<context>/subjects/<subject>/<version>.json
+//
+// Each file holds the SHA-256 of its JSON body on the first line. Files
+// whose checksum does not match are treated as missing and removed.
+type diskCache struct {
+	dir string
+}
+
+type diskCacheEntry struct {
+	ID       int       `json:"id"`
+	GUID     string    `json:"guid,omitempty"`
+	Version  int       `json:"version,omitempty"`
+	Schema   string    `json:"schema"`
+	Metadata *Metadata `json:"metadata,omitempty"`
+	RuleSet  *RuleSet  `json:"ruleSet,omitempty"`
+}
+
+// SetPersistentCache keeps a copy of every schema the client fetches in
+// dir. Schemas looked up by ID or by a fixed version are then read from
+// dir when they are not in memory, before asking the registry, and the
+// latest version of a subject is read from dir when the registry cannot
+// be reached or fails with a 5xx response. Deleting a subject through the
+// client removes its entries. Schema IDs never change meaning, so ID entries never
+// expire. Passing "" disables the persistent cache.
+func (client *SchemaRegistryClient) SetPersistentCache(dir string) error {
+	if dir == "" {
+		client.diskCache = nil
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	client.diskCache = &diskCache{dir: dir}
+	return nil
+}
+
+func (client *SchemaRegistryClient) diskContext() string {
+	return url.QueryEscape(client.Context())
+}
+
+// The path helpers return "" when there is no persistent cache, which
+// readDiskSchema and writeDiskSchema ignore.
+func (client *SchemaRegistryClient) diskIDPath(schemaID int) string {
+	if client.diskCache == nil {
+		return ""
+	}
+	return filepath.Join(client.diskCache.dir, client.diskContext(), "ids", strconv.Itoa(schemaID)+".json")
+}
+
+func (client *SchemaRegistryClient) diskVersionPath(concreteSubject, version string) string {
+	if client.diskCache == nil {
+		return ""
+	}
+	return filepath.Join(client.diskCache.dir, client.diskContext(), "subjects",
+		url.QueryEscape(concreteSubject), url.QueryEscape(version)+".json")
+}
+
+// removeDiskSubject removes the entries of every version of a subject.
+func (client *SchemaRegistryClient) removeDiskSubject(concreteSubject string) {
+	if client.diskCache == nil {
+		return
+	}
+	os.RemoveAll(filepath.Join(client.diskCache.dir, client.diskContext(), "subjects", url.QueryEscape(concreteSubject)))
+}
+
+// unreachable reports whether err means the registry could not answer, a
+// transport error or a 5xx response, so that a disk entry may stand in
+// for its answer. Other responses, such as a 404 for a deleted subject or
+// a 401, are returned as they are.
+func unreachable(err error) bool {
+	var registryError *RegistryError
+	if errors.As(err, &registryError) {
+		return registryError.StatusCode >= 500
+	}
+	return true
+}
+
+// readDiskSchema returns nil when there is no persistent cache, no entry,
+// or the entry is corrupt.
+func (client *SchemaRegistryClient) readDiskSchema(path string) *Schema {
+	if client.diskCache == nil {
+		return nil
+	}
+	entry, err := readDiskCacheEntry(path)
+	client.instrumentation.CacheAccessed(DiskCache, err == nil)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			os.Remove(path)
+		}
+		return nil
+	}
+	return &Schema{id: entry.ID, guid: entry.GUID, schema: entry.Schema, version: entry.Version,
+		metadata: entry.Metadata, ruleSet: entry.RuleSet}
+}
+
+// writeDiskSchema stores a schema under every path given. Failing to
+// write the persistent cache never fails the request that fetched the
+// schema.
+func (client *SchemaRegistryClient) writeDiskSchema(schema *Schema, paths ...string) {
+	if client.diskCache == nil {
+		return
+	}
+	entry := diskCacheEntry{ID: schema.id, GUID: schema.guid, Version: schema.version, Schema: schema.schema,
+		Metadata: schema.metadata, RuleSet: schema.ruleSet}
+	for _, path := range paths {
+		writeDiskCacheEntry(path, entry)
+	}
+}
+
+func readDiskCacheEntry(path string) (*diskCacheEntry, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	newline := bytes.IndexByte(bs, '\n')
+	if newline < 0 {
+		return nil, fmt.Errorf("cache file %s has no checksum", path)
+	}
+	body := bs[newline+1:]
+	sum := sha256.Sum256(body)
+	if string(bs[:newline]) != hex.EncodeToString(sum[:]) {
+		return nil, fmt.Errorf("cache file %s failed its checksum", path)
+	}
+	entry := new(diskCacheEntry)
+	if err := json.Unmarshal(body, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// writeDiskCacheEntry writes to a temporary file in the same directory
+// and renames it into place, so readers never see a partial entry.
+func writeDiskCacheEntry(path string, entry diskCacheEntry) error {
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(body)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := fmt.Fprintf(tmp, "%s\n%s", hex.EncodeToString(sum[:]), body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,121 @@
+package schema_registry_helper
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPersistentCache(t *testing.T) {
+	dir := t.TempDir()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(SchemaResponse{Subject: "topic-value", Schema: `{"type":"object"}`, ID: 3, Version: 1})
+	}))
+
+	client := CreateSchemaRegistryClient(server.URL)
+	if err := client.SetPersistentCache(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetLatestSchema("topic", false); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	// A new client, as after a restart, can serve the same schemas while
+	// the registry is down.
+	restarted := CreateSchemaRegistryClient(server.URL)
+	if err := restarted.SetPersistentCache(dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, get := range []func() (*Schema, error){
+		func() (*Schema, error) { return restarted.GetSchema(3) },
+		func() (*Schema, error) { return restarted.GetSchemaByVersion("topic", 1, false) },
+		func() (*Schema, error) { return restarted.GetLatestSchema("topic", false) },
+	} {
+		schema, err := get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if schema.ID() != 3 || schema.Schema() != `{"type":"object"}` {
+			t.Errorf("got id %d schema %q", schema.ID(), schema.Schema())
+		}
+	}
+
+	// A corrupted entry is ignored.
+	path := filepath.Join(dir, ".", "ids", "3.json")
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs[len(bs)-2] = 'x'
+	if err := ioutil.WriteFile(path, bs, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateSchemaRegistryClient(server.URL).GetSchema(3); err == nil {
+		t.Error("expected an error without a persistent cache")
+	}
+	corrupted := CreateSchemaRegistryClient(server.URL)
+	corrupted.SetPersistentCache(dir)
+	if _, err := corrupted.GetSchema(3); err == nil {
+		t.Error("expected an error for a corrupted entry")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected the corrupted entry to be removed")
+	}
+}
+
+func TestPersistentCacheDeletedSubject(t *testing.T) {
+	dir := t.TempDir()
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "DELETE":
+			json.NewEncoder(w).Encode([]int{1})
+		case status == http.StatusNotFound:
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error_code": ErrorCodeSubjectNotFound, "message": "Subject 'topic-value' not found."})
+		case status != http.StatusOK:
+			w.WriteHeader(status)
+		default:
+			json.NewEncoder(w).Encode(SchemaResponse{Subject: "topic-value", Schema: `{"type":"object"}`, ID: 3, Version: 1})
+		}
+	}))
+	defer server.Close()
+
+	client := CreateSchemaRegistryClient(server.URL)
+	if err := client.SetPersistentCache(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetLatestSchema("topic", false); err != nil {
+		t.Fatal(err)
+	}
+	restarted := CreateSchemaRegistryClient(server.URL)
+	restarted.SetPersistentCache(dir)
+
+	// The disk entry stands in for a failing registry, but not for one
+	// that says the subject is gone.
+	status = http.StatusServiceUnavailable
+	if _, err := restarted.GetLatestSchema("topic", false); err != nil {
+		t.Errorf("expected the disk entry for a 503, got %v", err)
+	}
+	status = http.StatusNotFound
+	if _, err := restarted.GetLatestSchema("topic", false); err == nil {
+		t.Error("expected a 404 for a deleted subject")
+	}
+
+	// Deleting the subject removes its disk entries.
+	if _, err := client.DeleteSubject("topic", false, false); err != nil {
+		t.Fatal(err)
+	}
+	status = http.StatusServiceUnavailable
+	if _, err := restarted.GetLatestSchema("topic", false); err == nil {
+		t.Error("expected no disk entry after the subject was deleted")
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".", "subjects", "topic-value")); !os.IsNotExist(err) {
+		t.Errorf("expected the subject's entries to be removed, got %v", err)
+	}
+}
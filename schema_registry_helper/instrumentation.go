@@ -0,0 +1,102 @@
+package schema_registry_helper
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Names of the client caches, as reported to Instrumentation.
+const (
+	IDSchemaCache      = "idSchemaCache"
+	SubjectSchemaCache = "subjectSchemaCache"
+	IDSubjectsCache    = "idSubjectsCache"
+	IDVersionsCache    = "idVersionsCache"
+	ReferencedByCache  = "referencedByCache"
+)
+
+// Instrumentation receives measurements from a SchemaRegistryClient.
+// Adapters for metrics and tracing libraries such as Prometheus or
+// OpenTelemetry implement it; embed NopInstrumentation to implement only
+// the methods of interest.
+//
+// Endpoints are reported as path templates, e.g.
+// "/subjects/{subject}/versions/{version}", so they can be used as
+// metric labels.
+type Instrumentation interface {
+	// RequestStarted is called before every HTTP request is sent,
+	// including retries. It may add headers to req, such as the trace
+	// context of a client span; req.Context() is the context given to
+	// WithRequestContext, or context.Background(). The returned function is called when the
+	// request completes, with the response status (0 if no response was
+	// received) and the error, if any.
+	RequestStarted(req *http.Request, endpoint string) func(status int, err error)
+
+	// CacheAccessed is called for every lookup in a client cache while
+	// caching is enabled.
+	CacheAccessed(cache string, hit bool)
+
+	// CacheEvicted is called when entries are dropped from a cache
+	// because they may be stale.
+	CacheEvicted(cache string, count int)
+
+	// RequestRetried is called before a failed request is retried.
+	// attempt counts from 1 for the first retry.
+	RequestRetried(endpoint string, attempt int, err error)
+}
+
+// NopInstrumentation ignores every measurement. It is the default
+// Instrumentation of a client.
+type NopInstrumentation struct{}
+
+func (NopInstrumentation) RequestStarted(req *http.Request, endpoint string) func(status int, err error) {
+	return func(int, error) {}
+}
+
+func (NopInstrumentation) CacheAccessed(cache string, hit bool) {}
+
+func (NopInstrumentation) CacheEvicted(cache string, count int) {}
+
+func (NopInstrumentation) RequestRetried(endpoint string, attempt int, err error) {}
+
+// SetInstrumentation installs hooks that observe every registry request,
+// cache lookup and retry made by the client. Passing nil removes them.
+func (client *SchemaRegistryClient) SetInstrumentation(instrumentation Instrumentation) {
+	if instrumentation == nil {
+		instrumentation = NopInstrumentation{}
+	}
+	client.instrumentation = instrumentation
+}
+
+// SetRetries allows the client to retry requests that fail because of a
+// network error, a 429 or a 5xx response. The first retry waits for
+// backoff and each later one twice as long as the one before. By
+// default, requests are not retried.
+func (client *SchemaRegistryClient) SetRetries(retries int, backoff time.Duration) {
+	client.retries = retries
+	client.retryBackoff = backoff
+}
+
+func shouldRetry(status int, err error) bool {
+	return err != nil || status == http.StatusTooManyRequests || status >= 500
+}
+
+// endpointLabel turns a request URI into its path template by replacing
+// the subject, schema ID and version segments.
+func endpointLabel(uri string) string {
+	if i := strings.IndexByte(uri, '?'); i >= 0 {
+		uri = uri[:i]
+	}
+	segments := strings.Split(uri, "/")
+	for i := 1; i < len(segments); i++ {
+		switch segments[i-1] {
+		case "subjects":
+			segments[i] = "{subject}"
+		case "ids":
+			segments[i] = "{id}"
+		case "versions":
+			segments[i] = "{version}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
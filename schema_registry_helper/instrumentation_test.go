@@ -0,0 +1,131 @@
+package schema_registry_helper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type recordingInstrumentation struct {
+	NopInstrumentation
+	requests []string
+	hits     map[string]int
+	misses   map[string]int
+	retries  int
+}
+
+func (r *recordingInstrumentation) RequestStarted(req *http.Request, endpoint string) func(int, error) {
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	return func(status int, err error) {
+		r.requests = append(r.requests, endpoint+" "+http.StatusText(status))
+	}
+}
+
+func (r *recordingInstrumentation) CacheAccessed(cache string, hit bool) {
+	if hit {
+		r.hits[cache]++
+	} else {
+		r.misses[cache]++
+	}
+}
+
+func (r *recordingInstrumentation) RequestRetried(endpoint string, attempt int, err error) {
+	r.retries++
+}
+
+func TestInstrumentation(t *testing.T) {
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("traceparent") == "" {
+			t.Error("missing traceparent header")
+		}
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(SchemaResponse{Schema: "{}", ID: 4, Version: 2})
+	}))
+	defer server.Close()
+
+	instrumentation := &recordingInstrumentation{hits: map[string]int{}, misses: map[string]int{}}
+	client := CreateSchemaRegistryClient(server.URL)
+	client.SetInstrumentation(instrumentation)
+	client.SetRetries(2, 0)
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetSchemaByVersion("topic", 2, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []string{
+		"/subjects/{subject}/versions/{version} Service Unavailable",
+		"/subjects/{subject}/versions/{version} OK",
+	}
+	if len(instrumentation.requests) != len(expected) {
+		t.Fatalf("got requests %v, wanted %v", instrumentation.requests, expected)
+	}
+	for i := range expected {
+		if instrumentation.requests[i] != expected[i] {
+			t.Errorf("got request %q, wanted %q", instrumentation.requests[i], expected[i])
+		}
+	}
+	if instrumentation.retries != 1 {
+		t.Errorf("got %d retries, wanted 1", instrumentation.retries)
+	}
+	if instrumentation.misses[SubjectSchemaCache] != 1 || instrumentation.hits[SubjectSchemaCache] != 1 {
+		t.Errorf("got hits %v misses %v", instrumentation.hits, instrumentation.misses)
+	}
+}
+
+type traceKey struct{}
+
+// contextInstrumentation propagates a trace ID from the request context,
+// as a tracing adapter would.
+type contextInstrumentation struct {
+	NopInstrumentation
+}
+
+func (contextInstrumentation) RequestStarted(req *http.Request, endpoint string) func(int, error) {
+	if traceID, ok := req.Context().Value(traceKey{}).(string); ok {
+		req.Header.Set("traceparent", "00-"+traceID+"-b7ad6b7169203331-01")
+	}
+	return func(int, error) {}
+}
+
+func TestInstrumentationRequestContext(t *testing.T) {
+	var headers []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Get("traceparent"))
+		json.NewEncoder(w).Encode(SchemaResponse{Schema: "{}", ID: 4, Version: 2})
+	}))
+	defer server.Close()
+
+	client := CreateSchemaRegistryClient(server.URL)
+	client.SetInstrumentation(contextInstrumentation{})
+	ctx := context.WithValue(context.Background(), traceKey{}, "0af7651916cd43dd8448eb211c80319c")
+	if _, err := client.WithRequestContext(ctx).GetSchemaByVersion("topic", 2, false); err != nil {
+		t.Fatal(err)
+	}
+	// The scoped client shares the caches, so this is not requested again.
+	if _, err := client.WithRequestContext(context.Background()).GetSchemaByVersion("topic", 2, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetSchema(7); err != nil {
+		t.Fatal(err)
+	}
+	expected := "[00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01 ]"
+	if fmt.Sprint(headers) != expected {
+		t.Errorf("got headers %v, wanted %s", headers, expected)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.WithRequestContext(cancelled).GetSchema(5); err == nil {
+		t.Error("expected an error for a cancelled context")
+	}
+}
@@ -0,0 +1,189 @@
+package schema_registry_helper
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// jsonSchema is the subset of JSON Schema produced by JSONSchemaFor.
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Ref                  string                 `json:"$ref,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	ContentEncoding      string                 `json:"contentEncoding,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Definitions          map[string]*jsonSchema `json:"definitions,omitempty"`
+}
+
+// JSONSchemaFor derives a draft-07 JSON Schema from the Go type of value,
+// following the rules encoding/json uses to marshal it: json struct tags
+// name properties, "-" fields are skipped, and embedded structs are
+// flattened. Fields without omitempty that are not pointers are required.
+// Named struct types other than the top-level one are placed in
+// "definitions" and referenced, which also allows recursive types.
+func JSONSchemaFor(value interface{}) (string, error) {
+	t := reflect.TypeOf(value)
+	if t == nil {
+		return "", fmt.Errorf("cannot derive a schema from a nil interface")
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	g := &jsonSchemaGenerator{definitions: make(map[string]*jsonSchema)}
+	root, err := g.structOrType(t)
+	if err != nil {
+		return "", err
+	}
+	root.Schema = jsonSchemaDraft
+	root.Title = t.Name()
+	if len(g.definitions) > 0 {
+		root.Definitions = g.definitions
+	}
+
+	bs, err := json.MarshalIndent(root, "", "    ")
+	if err != nil {
+		return "", err
+	}
+	return string(bs), nil
+}
+
+type jsonSchemaGenerator struct {
+	definitions map[string]*jsonSchema
+}
+
+func (g *jsonSchemaGenerator) structOrType(t reflect.Type) (*jsonSchema, error) {
+	if t.Kind() == reflect.Struct && t != timeType {
+		return g.object(t)
+	}
+	return g.schemaFor(t)
+}
+
+func (g *jsonSchemaGenerator) schemaFor(t reflect.Type) (*jsonSchema, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return &jsonSchema{Type: "string", Format: "date-time"}, nil
+	}
+	if t.Implements(reflect.TypeOf((*json.Marshaler)(nil)).Elem()) {
+		// Custom marshalling can produce anything.
+		return &jsonSchema{}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &jsonSchema{Type: "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return &jsonSchema{Type: "number"}, nil
+	case reflect.String:
+		return &jsonSchema{Type: "string"}, nil
+	case reflect.Interface:
+		return &jsonSchema{}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &jsonSchema{Type: "string", ContentEncoding: "base64"}, nil
+		}
+		items, err := g.schemaFor(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &jsonSchema{Type: "array", Items: items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("map key type %s is not supported", t.Key())
+		}
+		values, err := g.schemaFor(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &jsonSchema{Type: "object", AdditionalProperties: values}, nil
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := t.Name()
+		if _, ok := g.definitions[name]; !ok {
+			// Reserve the name before recursing so that self references
+			// resolve to the definition being built.
+			g.definitions[name] = &jsonSchema{}
+			object, err := g.object(t)
+			if err != nil {
+				return nil, err
+			}
+			g.definitions[name] = object
+		}
+		return &jsonSchema{Ref: "#/definitions/" + name}, nil
+	default:
+		return nil, fmt.Errorf("type %s cannot be represented in JSON", t)
+	}
+}
+
+func (g *jsonSchemaGenerator) object(t reflect.Type) (*jsonSchema, error) {
+	object := &jsonSchema{Type: "object", Properties: make(map[string]*jsonSchema)}
+	if err := g.addFields(object, t); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+func (g *jsonSchemaGenerator) addFields(object *jsonSchema, t reflect.Type) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options := tag, ""
+		if comma := strings.IndexByte(tag, ','); comma >= 0 {
+			name, options = tag[:comma], tag[comma+1:]
+		}
+
+		fieldType := field.Type
+		if field.Anonymous && name == "" {
+			for fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				if err := g.addFields(object, fieldType); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property, err := g.schemaFor(field.Type)
+		if err != nil {
+			return fmt.Errorf("field %s.%s: %v", t.Name(), field.Name, err)
+		}
+		if strings.Contains(options, "string") && property.Type != "" && property.Type != "object" && property.Type != "array" {
+			property = &jsonSchema{Type: "string"}
+		}
+		object.Properties[name] = property
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Ptr {
+			object.Required = append(object.Required, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,396 @@
+package schema_registry_helper
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// MemorySchemaRegistry is an in-memory SchemaRegistry that needs no HTTP
+// server. It assigns IDs and versions the way Schema Registry does: a
+// schema registered under several subjects keeps a single ID, and each
+// subject numbers its versions from 1. Errors use the same messages as
+// the HTTP client, so ErrNotFound checks behave identically.
+type MemorySchemaRegistry struct {
+	lock       sync.RWMutex
+	nextID     int
+	schemas    map[int]*memorySchema
+	subjects   map[string][]SubjectVersion
+	versionIDs map[string]int
+	// compatibility holds the levels set by SetCompatibility, by concrete
+	// subject, and the global level under "".
+	compatibility map[string]string
+}
+
+type memorySchema struct {
+	schema     string
+	schemaType SchemaType
+	references []Reference
+	metadata   *Metadata
+	ruleSet    *RuleSet
+}
+
+var _ SchemaRegistry = (*MemorySchemaRegistry)(nil)
+
+// NewMemorySchemaRegistry creates an empty in-memory registry.
+func NewMemorySchemaRegistry() *MemorySchemaRegistry {
+	return &MemorySchemaRegistry{
+		nextID:        1,
+		schemas:       make(map[int]*memorySchema),
+		subjects:      make(map[string][]SubjectVersion),
+		versionIDs:    make(map[string]int),
+		compatibility: make(map[string]string),
+	}
+}
+
+// GetSchema gets the schema associated with the given id.
+func (registry *MemorySchemaRegistry) GetSchema(schemaID int) (*Schema, error) {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+
+	s, ok := registry.schemas[schemaID]
+	if !ok {
+		return nil, notFoundError("Schema %d not found", schemaID)
+	}
+	return &Schema{id: schemaID, schema: s.schema, metadata: s.metadata, ruleSet: s.ruleSet}, nil
+}
+
+// GetSubjectsBySchemaID returns the subjects that have registered the
+// schema with the given id.
+func (registry *MemorySchemaRegistry) GetSubjectsBySchemaID(schemaID int) ([]string, error) {
+	versions, err := registry.GetVersionsBySchemaID(schemaID)
+	if err != nil {
+		return nil, err
+	}
+	subjects := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, v := range versions {
+		if !seen[v.Subject] {
+			seen[v.Subject] = true
+			subjects = append(subjects, v.Subject)
+		}
+	}
+	return subjects, nil
+}
+
+// GetVersionsBySchemaID returns every subject version that uses the
+// schema with the given id.
+func (registry *MemorySchemaRegistry) GetVersionsBySchemaID(schemaID int) ([]SubjectVersion, error) {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+
+	if _, ok := registry.schemas[schemaID]; !ok {
+		return nil, notFoundError("Schema %d not found", schemaID)
+	}
+	versions := make([]SubjectVersion, 0)
+	for _, subject := range registry.sortedSubjects() {
+		for _, v := range registry.subjects[subject] {
+			if registry.versionIDs[cacheKey(subject, fmt.Sprint(v.Version))] == schemaID {
+				versions = append(versions, v)
+			}
+		}
+	}
+	return versions, nil
+}
+
+// GetReferencedBy returns the ids of the schemas that reference the
+// given version of a subject.
+func (registry *MemorySchemaRegistry) GetReferencedBy(subject string, version int, isKey bool) ([]int, error) {
+	concreteSubject := getConcreteSubject(subject, isKey)
+
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+
+	if _, err := registry.version(concreteSubject, version); err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0)
+	for id, s := range registry.schemas {
+		for _, r := range s.references {
+			if r.Subject == concreteSubject && r.Version == version {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// GetLatestSchema gets the schema associated with the given subject.
+// The schema returned contains the last version for that subject.
+func (registry *MemorySchemaRegistry) GetLatestSchema(subject string, isKey bool) (*Schema, error) {
+	concreteSubject := getConcreteSubject(subject, isKey)
+
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+
+	versions, ok := registry.subjects[concreteSubject]
+	if !ok {
+		return nil, notFoundError("Subject '%s' not found.", concreteSubject)
+	}
+	return registry.version(concreteSubject, versions[len(versions)-1].Version)
+}
+
+// GetLatestSchemaWithMetadata gets the latest version of the given subject
+// whose metadata properties include every key and value in metadata.
+func (registry *MemorySchemaRegistry) GetLatestSchemaWithMetadata(subject string,
+	metadata map[string]string, isKey bool) (*Schema, error) {
+
+	concreteSubject := getConcreteSubject(subject, isKey)
+
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+
+	versions, ok := registry.subjects[concreteSubject]
+	if !ok {
+		return nil, notFoundError("Subject '%s' not found.", concreteSubject)
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		schema, err := registry.version(concreteSubject, versions[i].Version)
+		if err != nil {
+			return nil, err
+		}
+		if hasProperties(schema.metadata, metadata) {
+			return schema, nil
+		}
+	}
+	return nil, notFoundError("Schema not found")
+}
+
+// GetSchemaVersions returns a list of versions from a given subject.
+func (registry *MemorySchemaRegistry) GetSchemaVersions(subject string, isKey bool) ([]int, error) {
+	concreteSubject := getConcreteSubject(subject, isKey)
+
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+
+	subjectVersions, ok := registry.subjects[concreteSubject]
+	if !ok {
+		return nil, notFoundError("Subject '%s' not found.", concreteSubject)
+	}
+	versions := make([]int, len(subjectVersions))
+	for i, v := range subjectVersions {
+		versions[i] = v.Version
+	}
+	return versions, nil
+}
+
+// GetSchemaByVersion gets the schema associated with the given subject.
+// The schema returned contains the version specified as a parameter.
+func (registry *MemorySchemaRegistry) GetSchemaByVersion(subject string, version int, isKey bool) (*Schema, error) {
+	concreteSubject := getConcreteSubject(subject, isKey)
+
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+
+	return registry.version(concreteSubject, version)
+}
+
+// CheckSchema looks up a schema under the subject provided and returns
+// its registered information, or an ErrNotFound error if the subject has
+// no version with that schema.
+func (registry *MemorySchemaRegistry) CheckSchema(subject, schema string,
+	schemaType SchemaType, isKey bool, references ...Reference) (*SchemaResponse, error) {
+	return registry.CheckSchemaWithRules(subject, schema, schemaType, isKey, nil, nil, references...)
+}
+
+// CheckSchemaWithRules behaves like CheckSchema, but only matches a
+// version registered with the same metadata and rule set.
+func (registry *MemorySchemaRegistry) CheckSchemaWithRules(subject, schema string, schemaType SchemaType, isKey bool,
+	metadata *Metadata, ruleSet *RuleSet, references ...Reference) (*SchemaResponse, error) {
+
+	concreteSubject := getConcreteSubject(subject, isKey)
+
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+
+	if _, ok := registry.subjects[concreteSubject]; !ok {
+		return nil, notFoundError("Subject '%s' not found.", concreteSubject)
+	}
+	existing := registry.find(concreteSubject, &memorySchema{schema, schemaType, references, metadata, ruleSet})
+	if existing == nil {
+		return nil, notFoundError("Schema not found")
+	}
+	return existing, nil
+}
+
+// CreateSchema registers a schema under the subject provided. Registering
+// a schema the subject already has returns the existing version.
+func (registry *MemorySchemaRegistry) CreateSchema(subject, schema string,
+	schemaType SchemaType, isKey bool, references ...Reference) (*Schema, error) {
+	return registry.CreateSchemaWithRules(subject, schema, schemaType, isKey, nil, nil, references...)
+}
+
+// CreateSchemaWithRules behaves like CreateSchema, but registers the
+// schema version with data contract metadata and rules.
+func (registry *MemorySchemaRegistry) CreateSchemaWithRules(subject, schema string, schemaType SchemaType, isKey bool,
+	metadata *Metadata, ruleSet *RuleSet, references ...Reference) (*Schema, error) {
+
+	concreteSubject := getConcreteSubject(subject, isKey)
+
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	for _, r := range references {
+		if _, err := registry.version(r.Subject, r.Version); err != nil {
+			return nil, err
+		}
+	}
+	candidate := &memorySchema{schema, schemaType, references, metadata, ruleSet}
+	if existing := registry.find(concreteSubject, candidate); existing != nil {
+		return &Schema{id: existing.ID, schema: existing.Schema, version: existing.Version,
+			metadata: metadata, ruleSet: ruleSet}, nil
+	}
+
+	id := registry.idFor(candidate)
+	version := 1
+	if versions := registry.subjects[concreteSubject]; len(versions) > 0 {
+		version = versions[len(versions)-1].Version + 1
+	}
+	registry.subjects[concreteSubject] = append(registry.subjects[concreteSubject],
+		SubjectVersion{Subject: concreteSubject, Version: version})
+	registry.versionIDs[cacheKey(concreteSubject, fmt.Sprint(version))] = id
+	return &Schema{id: id, schema: schema, version: version, metadata: metadata, ruleSet: ruleSet}, nil
+}
+
+// GetContexts returns the default context, the only one an in-memory
+// registry has.
+func (registry *MemorySchemaRegistry) GetContexts() ([]string, error) {
+	return []string{DefaultContext}, nil
+}
+
+// DeleteSubject removes every version of a subject and returns their
+// numbers. The in-memory registry keeps no deleted versions, so a soft
+// delete is permanent and a later registration starts again at version 1.
+// Schema IDs stay assigned.
+func (registry *MemorySchemaRegistry) DeleteSubject(subject string, isKey bool, permanent bool) ([]int, error) {
+	concreteSubject := getConcreteSubject(subject, isKey)
+
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	subjectVersions, ok := registry.subjects[concreteSubject]
+	if !ok {
+		return nil, notFoundError("Subject '%s' not found.", concreteSubject)
+	}
+	versions := make([]int, len(subjectVersions))
+	for i, v := range subjectVersions {
+		versions[i] = v.Version
+		delete(registry.versionIDs, cacheKey(concreteSubject, fmt.Sprint(v.Version)))
+	}
+	delete(registry.subjects, concreteSubject)
+	delete(registry.compatibility, concreteSubject)
+	return versions, nil
+}
+
+// GetCompatibility returns the compatibility level of a subject, falling
+// back to the global level, which is BACKWARD unless it was set. An empty
+// subject returns the global level. Levels are recorded but not enforced.
+func (registry *MemorySchemaRegistry) GetCompatibility(subject string, isKey bool) (string, error) {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+
+	if subject != "" {
+		if level, ok := registry.compatibility[getConcreteSubject(subject, isKey)]; ok {
+			return level, nil
+		}
+	}
+	if level, ok := registry.compatibility[""]; ok {
+		return level, nil
+	}
+	return CompatibilityBackward, nil
+}
+
+// SetCompatibility sets the compatibility level of a subject, or the
+// global level if subject is empty.
+func (registry *MemorySchemaRegistry) SetCompatibility(subject string, isKey bool, level string) error {
+	switch level {
+	case CompatibilityNone, CompatibilityBackward, CompatibilityBackwardTransitive, CompatibilityForward,
+		CompatibilityForwardTransitive, CompatibilityFull, CompatibilityFullTransitive:
+	default:
+		return fmt.Errorf("Invalid compatibility level %q", level)
+	}
+	key := ""
+	if subject != "" {
+		key = getConcreteSubject(subject, isKey)
+	}
+
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	registry.compatibility[key] = level
+	return nil
+}
+
+func (registry *MemorySchemaRegistry) version(concreteSubject string, version int) (*Schema, error) {
+	if _, ok := registry.subjects[concreteSubject]; !ok {
+		return nil, notFoundError("Subject '%s' not found.", concreteSubject)
+	}
+	id, ok := registry.versionIDs[cacheKey(concreteSubject, fmt.Sprint(version))]
+	if !ok {
+		return nil, notFoundError("Version %d not found.", version)
+	}
+	s := registry.schemas[id]
+	return &Schema{id: id, schema: s.schema, version: version, metadata: s.metadata, ruleSet: s.ruleSet}, nil
+}
+
+func (registry *MemorySchemaRegistry) find(concreteSubject string, candidate *memorySchema) *SchemaResponse {
+	for _, v := range registry.subjects[concreteSubject] {
+		id := registry.versionIDs[cacheKey(concreteSubject, fmt.Sprint(v.Version))]
+		if registry.schemas[id].matches(candidate) {
+			return &SchemaResponse{Subject: concreteSubject, Version: v.Version, Schema: candidate.schema, ID: id,
+				Metadata: candidate.metadata, RuleSet: candidate.ruleSet}
+		}
+	}
+	return nil
+}
+
+// idFor returns the ID already assigned to an identical schema, or
+// assigns the next one.
+func (registry *MemorySchemaRegistry) idFor(candidate *memorySchema) int {
+	for id, s := range registry.schemas {
+		if s.matches(candidate) {
+			return id
+		}
+	}
+	id := registry.nextID
+	registry.nextID++
+	registry.schemas[id] = candidate
+	return id
+}
+
+func (registry *MemorySchemaRegistry) sortedSubjects() []string {
+	subjects := make([]string, 0, len(registry.subjects))
+	for subject := range registry.subjects {
+		subjects = append(subjects, subject)
+	}
+	sort.Strings(subjects)
+	return subjects
+}
+
+func (s *memorySchema) matches(other *memorySchema) bool {
+	if s.schema != other.schema || s.schemaType != other.schemaType || len(s.references) != len(other.references) {
+		return false
+	}
+	for i := range other.references {
+		if s.references[i] != other.references[i] {
+			return false
+		}
+	}
+	return reflect.DeepEqual(s.metadata, other.metadata) && reflect.DeepEqual(s.ruleSet, other.ruleSet)
+}
+
+func hasProperties(metadata *Metadata, properties map[string]string) bool {
+	for k, v := range properties {
+		if metadata == nil || metadata.Properties[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func notFoundError(format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %s", ErrNotFound, fmt.Sprintf(format, args...))
+}
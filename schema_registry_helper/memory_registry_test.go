@@ -0,0 +1,96 @@
+package schema_registry_helper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExportSchemaToMemoryRegistry(t *testing.T) {
+	registry := NewMemorySchemaRegistry()
+
+	version, err := ExportSchema([]byte(`{"type": "object"}`), "service-Event", Json, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 1 {
+		t.Errorf("got version %d, wanted 1", version)
+	}
+
+	// Exporting the same schema again finds the existing version.
+	version, err = ExportSchema([]byte(`{"type": "object"}`), "service-Event", Json, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 1 {
+		t.Errorf("got version %d, wanted 1", version)
+	}
+
+	version, err = ExportSchema([]byte(`{"type": "string"}`), "service-Event", Json, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 2 {
+		t.Errorf("got version %d, wanted 2", version)
+	}
+
+	// The same schema under another subject shares its ID.
+	other, err := registry.CreateSchema("service-Other", `{"type": "object"}`, Json, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.ID() != 1 || other.Version() != 1 {
+		t.Errorf("got id %d version %d, wanted id 1 version 1", other.ID(), other.Version())
+	}
+	subjects, err := registry.GetSubjectsBySchemaID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subjects) != 2 || subjects[0] != "service-Event-value" || subjects[1] != "service-Other-value" {
+		t.Errorf("got subjects %v", subjects)
+	}
+
+	latest, err := registry.GetLatestSchema("service-Event", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.ID() != 2 || latest.Schema() != `{"type": "string"}` {
+		t.Errorf("got latest id %d schema %q", latest.ID(), latest.Schema())
+	}
+
+	if _, err := registry.GetSchemaVersions("missing", false); err == nil {
+		t.Error("expected an error for a missing subject")
+	}
+}
+
+func TestMemorySchemaRegistryAdmin(t *testing.T) {
+	registry := NewMemorySchemaRegistry()
+	for _, schema := range []string{`{"type": "object"}`, `{"type": "string"}`} {
+		if _, err := registry.CreateSchema("service-Event", schema, Json, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if level, err := registry.GetCompatibility("service-Event", false); err != nil || level != CompatibilityBackward {
+		t.Errorf("got %q %v", level, err)
+	}
+	if err := registry.SetCompatibility("service-Event", false, CompatibilityFull); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.SetCompatibility("", false, "SOMETIMES"); err == nil {
+		t.Error("expected an error for an invalid level")
+	}
+	if level, _ := registry.GetCompatibility("service-Event", false); level != CompatibilityFull {
+		t.Errorf("got %q", level)
+	}
+
+	versions, err := registry.DeleteSubject("service-Event", false, false)
+	if err != nil || len(versions) != 2 {
+		t.Fatalf("got %v %v", versions, err)
+	}
+	if _, err := registry.GetLatestSchema("service-Event", false); err == nil || !strings.Contains(err.Error(), ErrNotFound) {
+		t.Errorf("got %v after deleting the subject", err)
+	}
+	if _, err := registry.DeleteSubject("service-Event", false, false); err == nil {
+		t.Error("expected an error deleting a missing subject")
+	}
+}
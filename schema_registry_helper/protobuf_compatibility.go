@@ -0,0 +1,514 @@
+package schema_registry_helper
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ProtobufDifferenceType names a single change between two versions of a
+// Protobuf schema. The values mirror the difference types reported by the
+// Confluent Schema Registry's Protobuf compatibility checker.
+type ProtobufDifferenceType string
+
+func (t ProtobufDifferenceType) String() string {
+	return string(t)
+}
+
+const (
+	PackageChanged                 ProtobufDifferenceType = "PACKAGE_CHANGED"
+	MessageAdded                   ProtobufDifferenceType = "MESSAGE_ADDED"
+	MessageRemoved                 ProtobufDifferenceType = "MESSAGE_REMOVED"
+	EnumAdded                      ProtobufDifferenceType = "ENUM_ADDED"
+	EnumRemoved                    ProtobufDifferenceType = "ENUM_REMOVED"
+	EnumConstAdded                 ProtobufDifferenceType = "ENUM_CONST_ADDED"
+	EnumConstChanged               ProtobufDifferenceType = "ENUM_CONST_CHANGED"
+	EnumConstRemoved               ProtobufDifferenceType = "ENUM_CONST_REMOVED"
+	FieldAdded                     ProtobufDifferenceType = "FIELD_ADDED"
+	FieldRemoved                   ProtobufDifferenceType = "FIELD_REMOVED"
+	FieldNameChanged               ProtobufDifferenceType = "FIELD_NAME_CHANGED"
+	FieldKindChanged               ProtobufDifferenceType = "FIELD_KIND_CHANGED"
+	FieldScalarKindChanged         ProtobufDifferenceType = "FIELD_SCALAR_KIND_CHANGED"
+	FieldNamedTypeChanged          ProtobufDifferenceType = "FIELD_NAMED_TYPE_CHANGED"
+	FieldNumericLabelChanged       ProtobufDifferenceType = "FIELD_NUMERIC_LABEL_CHANGED"
+	FieldStringOrBytesLabelChanged ProtobufDifferenceType = "FIELD_STRING_OR_BYTES_LABEL_CHANGED"
+	RequiredFieldAdded             ProtobufDifferenceType = "REQUIRED_FIELD_ADDED"
+	RequiredFieldRemoved           ProtobufDifferenceType = "REQUIRED_FIELD_REMOVED"
+	OneofAdded                     ProtobufDifferenceType = "ONEOF_ADDED"
+	OneofRemoved                   ProtobufDifferenceType = "ONEOF_REMOVED"
+	OneofFieldAdded                ProtobufDifferenceType = "ONEOF_FIELD_ADDED"
+	OneofFieldRemoved              ProtobufDifferenceType = "ONEOF_FIELD_REMOVED"
+	MultipleFieldsMovedToOneof     ProtobufDifferenceType = "MULTIPLE_FIELDS_MOVED_TO_ONEOF"
+	FieldMovedToExistingOneof      ProtobufDifferenceType = "FIELD_MOVED_TO_EXISTING_ONEOF"
+)
+
+// These are the difference types the registry rejects when checking
+// BACKWARD compatibility. Every other difference is wire compatible.
+var incompatibleProtobufChanges = map[ProtobufDifferenceType]bool{
+	PackageChanged:             true,
+	MessageRemoved:             true,
+	FieldKindChanged:           true,
+	FieldScalarKindChanged:     true,
+	FieldNamedTypeChanged:      true,
+	RequiredFieldAdded:         true,
+	RequiredFieldRemoved:       true,
+	OneofFieldRemoved:          true,
+	MultipleFieldsMovedToOneof: true,
+	FieldMovedToExistingOneof:  true,
+}
+
+// Scalar kinds in the same group share a wire encoding, so a field can
+// move between them without breaking existing readers.
+var protobufScalarGroups = map[protoreflect.Kind]int{
+	protoreflect.Int32Kind:    1,
+	protoreflect.Uint32Kind:   1,
+	protoreflect.Int64Kind:    1,
+	protoreflect.Uint64Kind:   1,
+	protoreflect.BoolKind:     1,
+	protoreflect.Sint32Kind:   2,
+	protoreflect.Sint64Kind:   2,
+	protoreflect.Fixed32Kind:  3,
+	protoreflect.Sfixed32Kind: 3,
+	protoreflect.Fixed64Kind:  4,
+	protoreflect.Sfixed64Kind: 4,
+	protoreflect.StringKind:   5,
+	protoreflect.BytesKind:    5,
+	protoreflect.FloatKind:    6,
+	protoreflect.DoubleKind:   7,
+}
+
+const defaultProtobufFileName = "schema.proto"
+
+// ProtobufSchema is a single .proto file together with everything needed
+// to resolve its imports. Imports are keyed by the path used in the import
+// statement, which is also the Reference name used by the registry.
+// Anything not found in Imports is looked up in ImportPaths, and the
+// google/protobuf well-known types are always available.
+type ProtobufSchema struct {
+	Name        string
+	Schema      string
+	Imports     map[string]string
+	ImportPaths []string
+}
+
+// ProtobufDifference describes one change found between two versions
+// of a Protobuf schema.
+type ProtobufDifference struct {
+	Type         ProtobufDifferenceType
+	Path         string
+	Message      string
+	Incompatible bool
+}
+
+func (d ProtobufDifference) String() string {
+	return fmt.Sprintf("%s %s: %s", d.Type, d.Path, d.Message)
+}
+
+// ReadProtobufSchema loads a .proto file from disk. The directory that
+// contains the file is used as the first import path, followed by any
+// additional import paths given.
+func ReadProtobufSchema(path string, importPaths ...string) (ProtobufSchema, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ProtobufSchema{}, err
+	}
+	return ProtobufSchema{
+		Name:        filepath.Base(path),
+		Schema:      string(bs),
+		ImportPaths: append([]string{filepath.Dir(path)}, importPaths...),
+	}, nil
+}
+
+// CheckProtobufCompatibility parses two versions of a Protobuf schema and
+// returns every difference between them, without contacting a registry.
+// The comparison follows the registry's BACKWARD rules (consumers using
+// current can read data written with previous); swap the arguments to
+// check FORWARD compatibility.
+//
+// Removing a field or enum value whose number is not reserved in the new
+// version (so it can later be reused with a different meaning), and giving
+// an existing enum number a new name, are marked incompatible. With
+// lenient set they are only reported, as the Confluent registry tolerates
+// them.
+func CheckProtobufCompatibility(previous, current ProtobufSchema, lenient bool) ([]ProtobufDifference, error) {
+	oldFile, err := compileProtobuf(previous)
+	if err != nil {
+		return nil, fmt.Errorf("parsing previous schema: %v", err)
+	}
+	newFile, err := compileProtobuf(current)
+	if err != nil {
+		return nil, fmt.Errorf("parsing current schema: %v", err)
+	}
+
+	diff := &protobufDiff{
+		lenient:    lenient,
+		oldPackage: string(oldFile.Package()),
+		newPackage: string(newFile.Package()),
+	}
+	diff.compareFiles(oldFile, newFile)
+	return diff.differences, nil
+}
+
+// IsProtobufCompatible reports whether none of the given differences
+// would break existing readers.
+func IsProtobufCompatible(differences []ProtobufDifference) bool {
+	for _, d := range differences {
+		if d.Incompatible {
+			return false
+		}
+	}
+	return true
+}
+
+func compileProtobuf(schema ProtobufSchema) (protoreflect.FileDescriptor, error) {
+	name := schema.Name
+	if name == "" {
+		name = defaultProtobufFileName
+	}
+	sources := map[string]string{name: schema.Schema}
+	for path, content := range schema.Imports {
+		if path != name {
+			sources[path] = content
+		}
+	}
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(protocompile.CompositeResolver{
+			&protocompile.SourceResolver{Accessor: protocompile.SourceAccessorFromMap(sources)},
+			&protocompile.SourceResolver{ImportPaths: schema.ImportPaths},
+		}),
+	}
+	files, err := compiler.Compile(context.Background(), name)
+	if err != nil {
+		return nil, err
+	}
+	return files[0], nil
+}
+
+type protobufDiff struct {
+	lenient     bool
+	oldPackage  string
+	newPackage  string
+	differences []ProtobufDifference
+}
+
+func (d *protobufDiff) add(t ProtobufDifferenceType, path, format string, args ...interface{}) {
+	d.addWithSeverity(t, incompatibleProtobufChanges[t], path, format, args...)
+}
+
+func (d *protobufDiff) addWithSeverity(t ProtobufDifferenceType, incompatible bool, path, format string, args ...interface{}) {
+	d.differences = append(d.differences, ProtobufDifference{
+		Type:         t,
+		Path:         path,
+		Message:      fmt.Sprintf(format, args...),
+		Incompatible: incompatible,
+	})
+}
+
+// Types are matched by their name relative to the file's package, so that
+// a package rename is reported once rather than as every type changing.
+func relativeName(name protoreflect.FullName, pkg string) string {
+	if pkg == "" {
+		return string(name)
+	}
+	return strings.TrimPrefix(string(name), pkg+".")
+}
+
+func (d *protobufDiff) compareFiles(oldFile, newFile protoreflect.FileDescriptor) {
+	if d.oldPackage != d.newPackage {
+		d.add(PackageChanged, d.newPackage, "package changed from %q to %q", d.oldPackage, d.newPackage)
+	}
+
+	oldMessages := collectMessages(oldFile.Messages(), d.oldPackage, nil)
+	newMessages := collectMessages(newFile.Messages(), d.newPackage, nil)
+	for _, name := range sortedMessageNames(oldMessages) {
+		if newMessage, ok := newMessages[name]; ok {
+			d.compareMessages(name, oldMessages[name], newMessage)
+		} else {
+			d.add(MessageRemoved, name, "message %s was removed or renamed", name)
+		}
+	}
+	for _, name := range sortedMessageNames(newMessages) {
+		if _, ok := oldMessages[name]; !ok {
+			d.add(MessageAdded, name, "message %s was added", name)
+		}
+	}
+
+	oldEnums := collectEnums(oldFile.Enums(), oldFile.Messages(), d.oldPackage, nil)
+	newEnums := collectEnums(newFile.Enums(), newFile.Messages(), d.newPackage, nil)
+	for _, name := range sortedEnumNames(oldEnums) {
+		if newEnum, ok := newEnums[name]; ok {
+			d.compareEnums(name, oldEnums[name], newEnum)
+		} else {
+			d.add(EnumRemoved, name, "enum %s was removed", name)
+		}
+	}
+	for _, name := range sortedEnumNames(newEnums) {
+		if _, ok := oldEnums[name]; !ok {
+			d.add(EnumAdded, name, "enum %s was added", name)
+		}
+	}
+}
+
+func (d *protobufDiff) compareMessages(name string, oldMessage, newMessage protoreflect.MessageDescriptor) {
+	oldFields := oldMessage.Fields()
+	newFields := newMessage.Fields()
+
+	for i := 0; i < oldFields.Len(); i++ {
+		oldField := oldFields.Get(i)
+		path := fmt.Sprintf("%s.%s(%d)", name, oldField.Name(), oldField.Number())
+		newField := newFields.ByNumber(oldField.Number())
+		if newField == nil {
+			d.fieldRemoved(path, oldField, newMessage)
+			continue
+		}
+		d.compareFields(path, oldField, newField)
+	}
+	for i := 0; i < newFields.Len(); i++ {
+		newField := newFields.Get(i)
+		if oldFields.ByNumber(newField.Number()) != nil {
+			continue
+		}
+		path := fmt.Sprintf("%s.%s(%d)", name, newField.Name(), newField.Number())
+		if newField.Cardinality() == protoreflect.Required {
+			d.add(RequiredFieldAdded, path, "required field %s was added", newField.Name())
+		} else {
+			d.add(FieldAdded, path, "field %s was added", newField.Name())
+		}
+	}
+
+	d.compareOneofs(name, oldMessage, newMessage)
+}
+
+func (d *protobufDiff) fieldRemoved(path string, oldField protoreflect.FieldDescriptor, newMessage protoreflect.MessageDescriptor) {
+	if oldField.Cardinality() == protoreflect.Required {
+		d.add(RequiredFieldRemoved, path, "required field %s was removed", oldField.Name())
+		return
+	}
+	reserved := newMessage.ReservedRanges().Has(oldField.Number())
+	if reserved {
+		d.add(FieldRemoved, path, "field %s was removed and its number is reserved", oldField.Name())
+		return
+	}
+	d.addWithSeverity(FieldRemoved, !d.lenient, path,
+		"field %s was removed but number %d is not reserved", oldField.Name(), oldField.Number())
+}
+
+func (d *protobufDiff) compareFields(path string, oldField, newField protoreflect.FieldDescriptor) {
+	if oldField.Name() != newField.Name() {
+		d.add(FieldNameChanged, path, "field name changed from %s to %s", oldField.Name(), newField.Name())
+	}
+
+	oldRequired := oldField.Cardinality() == protoreflect.Required
+	newRequired := newField.Cardinality() == protoreflect.Required
+	if oldRequired && !newRequired {
+		d.add(RequiredFieldRemoved, path, "field %s is no longer required", newField.Name())
+	} else if !oldRequired && newRequired {
+		d.add(RequiredFieldAdded, path, "field %s is now required", newField.Name())
+	}
+
+	oldKind, newKind := fieldKind(oldField), fieldKind(newField)
+	switch {
+	case oldKind != newKind:
+		d.add(FieldKindChanged, path, "field kind changed from %s to %s", describeFieldType(oldField), describeFieldType(newField))
+	case oldKind == scalarField:
+		if oldField.Kind() != newField.Kind() && protobufScalarGroups[oldField.Kind()] != protobufScalarGroups[newField.Kind()] {
+			d.add(FieldScalarKindChanged, path, "field type changed from %s to %s", oldField.Kind(), newField.Kind())
+		}
+	default:
+		oldType, newType := d.namedType(oldField, d.oldPackage), d.namedType(newField, d.newPackage)
+		if oldType != newType {
+			d.add(FieldNamedTypeChanged, path, "field type changed from %s to %s", oldType, newType)
+		}
+	}
+
+	// A repeated message field and a singular one are interchangeable on
+	// the wire, so label changes only matter for scalars and enums.
+	if oldField.IsList() != newField.IsList() && oldKind == newKind {
+		switch {
+		case oldField.Kind() == protoreflect.StringKind || oldField.Kind() == protoreflect.BytesKind:
+			d.add(FieldStringOrBytesLabelChanged, path, "field %s changed between singular and repeated", newField.Name())
+		case oldKind != messageField:
+			d.add(FieldNumericLabelChanged, path, "field %s changed between singular and repeated", newField.Name())
+		}
+	}
+}
+
+func (d *protobufDiff) compareOneofs(name string, oldMessage, newMessage protoreflect.MessageDescriptor) {
+	oldOneofs := oldMessage.Oneofs()
+	newOneofs := newMessage.Oneofs()
+
+	for i := 0; i < oldOneofs.Len(); i++ {
+		oldOneof := oldOneofs.Get(i)
+		if oldOneof.IsSynthetic() {
+			continue
+		}
+		path := fmt.Sprintf("%s.%s", name, oldOneof.Name())
+		newOneof := newOneofs.ByName(oldOneof.Name())
+		if newOneof == nil || newOneof.IsSynthetic() {
+			d.add(OneofRemoved, path, "oneof %s was removed", oldOneof.Name())
+			continue
+		}
+		oldOneofFields := oldOneof.Fields()
+		for j := 0; j < oldOneofFields.Len(); j++ {
+			number := oldOneofFields.Get(j).Number()
+			if newOneof.Fields().ByNumber(number) == nil {
+				d.add(OneofFieldRemoved, path, "field number %d was removed from oneof %s", number, oldOneof.Name())
+			}
+		}
+		newOneofFields := newOneof.Fields()
+		for j := 0; j < newOneofFields.Len(); j++ {
+			field := newOneofFields.Get(j)
+			oldField := oldMessage.Fields().ByNumber(field.Number())
+			switch {
+			case oldField == nil:
+				d.add(OneofFieldAdded, path, "field %s was added to oneof %s", field.Name(), oldOneof.Name())
+			case oldField.ContainingOneof() == nil || oldField.ContainingOneof().IsSynthetic():
+				d.add(FieldMovedToExistingOneof, path, "existing field %s was moved into oneof %s", field.Name(), oldOneof.Name())
+			}
+		}
+	}
+
+	for i := 0; i < newOneofs.Len(); i++ {
+		newOneof := newOneofs.Get(i)
+		if newOneof.IsSynthetic() {
+			continue
+		}
+		oldOneof := oldOneofs.ByName(newOneof.Name())
+		if oldOneof != nil && !oldOneof.IsSynthetic() {
+			continue
+		}
+		path := fmt.Sprintf("%s.%s", name, newOneof.Name())
+		d.add(OneofAdded, path, "oneof %s was added", newOneof.Name())
+		moved := 0
+		newOneofFields := newOneof.Fields()
+		for j := 0; j < newOneofFields.Len(); j++ {
+			if oldMessage.Fields().ByNumber(newOneofFields.Get(j).Number()) != nil {
+				moved++
+			}
+		}
+		if moved > 1 {
+			d.add(MultipleFieldsMovedToOneof, path, "%d existing fields were moved into new oneof %s", moved, newOneof.Name())
+		}
+	}
+}
+
+func (d *protobufDiff) compareEnums(name string, oldEnum, newEnum protoreflect.EnumDescriptor) {
+	oldValues := oldEnum.Values()
+	newValues := newEnum.Values()
+
+	for i := 0; i < oldValues.Len(); i++ {
+		oldValue := oldValues.Get(i)
+		path := fmt.Sprintf("%s.%s(%d)", name, oldValue.Name(), oldValue.Number())
+		newValue := newValues.ByNumber(oldValue.Number())
+		switch {
+		case newValue == nil && newEnum.ReservedRanges().Has(oldValue.Number()):
+			d.add(EnumConstRemoved, path, "enum value %s was removed and its number is reserved", oldValue.Name())
+		case newValue == nil:
+			d.addWithSeverity(EnumConstRemoved, !d.lenient, path,
+				"enum value %s was removed but number %d is not reserved", oldValue.Name(), oldValue.Number())
+		case newValue.Name() != oldValue.Name():
+			d.addWithSeverity(EnumConstChanged, !d.lenient, path,
+				"enum value %d renamed from %s to %s", oldValue.Number(), oldValue.Name(), newValue.Name())
+		}
+	}
+	for i := 0; i < newValues.Len(); i++ {
+		newValue := newValues.Get(i)
+		if oldValues.ByNumber(newValue.Number()) == nil {
+			path := fmt.Sprintf("%s.%s(%d)", name, newValue.Name(), newValue.Number())
+			d.add(EnumConstAdded, path, "enum value %s was added", newValue.Name())
+		}
+	}
+}
+
+type protobufFieldKind int
+
+const (
+	scalarField protobufFieldKind = iota
+	enumField
+	messageField
+)
+
+func fieldKind(field protoreflect.FieldDescriptor) protobufFieldKind {
+	switch field.Kind() {
+	case protoreflect.EnumKind:
+		return enumField
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return messageField
+	default:
+		return scalarField
+	}
+}
+
+func describeFieldType(field protoreflect.FieldDescriptor) string {
+	switch fieldKind(field) {
+	case enumField:
+		return "enum " + string(field.Enum().FullName())
+	case messageField:
+		return "message " + string(field.Message().FullName())
+	default:
+		return field.Kind().String()
+	}
+}
+
+// namedType returns the package-relative name of a field's message or enum
+// type. Types imported from other packages keep their full name.
+func (d *protobufDiff) namedType(field protoreflect.FieldDescriptor, pkg string) string {
+	if fieldKind(field) == enumField {
+		return relativeName(field.Enum().FullName(), pkg)
+	}
+	return relativeName(field.Message().FullName(), pkg)
+}
+
+// collectMessages flattens nested messages into a single map. Map entry
+// messages are synthesized by the compiler and compared via their field.
+func collectMessages(messages protoreflect.MessageDescriptors, pkg string, set map[string]protoreflect.MessageDescriptor) map[string]protoreflect.MessageDescriptor {
+	if set == nil {
+		set = make(map[string]protoreflect.MessageDescriptor)
+	}
+	for i := 0; i < messages.Len(); i++ {
+		m := messages.Get(i)
+		if m.IsMapEntry() {
+			continue
+		}
+		set[relativeName(m.FullName(), pkg)] = m
+		collectMessages(m.Messages(), pkg, set)
+	}
+	return set
+}
+
+func collectEnums(enums protoreflect.EnumDescriptors, messages protoreflect.MessageDescriptors, pkg string, set map[string]protoreflect.EnumDescriptor) map[string]protoreflect.EnumDescriptor {
+	if set == nil {
+		set = make(map[string]protoreflect.EnumDescriptor)
+	}
+	for i := 0; i < enums.Len(); i++ {
+		set[relativeName(enums.Get(i).FullName(), pkg)] = enums.Get(i)
+	}
+	for i := 0; i < messages.Len(); i++ {
+		collectEnums(messages.Get(i).Enums(), messages.Get(i).Messages(), pkg, set)
+	}
+	return set
+}
+
+func sortedMessageNames(set map[string]protoreflect.MessageDescriptor) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedEnumNames(set map[string]protoreflect.EnumDescriptor) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,319 @@
+package schema_registry_helper
+
+import (
+	"testing"
+)
+
+const protobufBase = `syntax = "proto3";
+package events;
+
+import "common.proto";
+
+message Event {
+  string id = 1;
+  int32 count = 2;
+  Status status = 3;
+  common.Meta meta = 4;
+  oneof payload {
+    string text = 5;
+    bytes blob = 6;
+  }
+}
+
+enum Status {
+  UNKNOWN = 0;
+  RAISED = 1;
+  CLEARED = 2;
+}
+`
+
+const protobufCommon = `syntax = "proto3";
+package common;
+
+message Meta {
+  string source = 1;
+}
+`
+
+var testProtobufChanges = []struct {
+	name         string
+	schema       string
+	lenient      bool
+	expected     []ProtobufDifferenceType
+	incompatible bool
+}{
+	{
+		name:   "unchanged",
+		schema: protobufBase,
+	},
+	{
+		name: "field added and widened",
+		schema: `syntax = "proto3";
+package events;
+import "common.proto";
+message Event {
+  string id = 1;
+  int64 count = 2;
+  Status status = 3;
+  common.Meta meta = 4;
+  oneof payload {
+    string text = 5;
+    bytes blob = 6;
+  }
+  string extra = 7;
+}
+enum Status {
+  UNKNOWN = 0;
+  RAISED = 1;
+  CLEARED = 2;
+  REMINDER = 3;
+}
+`,
+		expected: []ProtobufDifferenceType{FieldAdded, EnumConstAdded},
+	},
+	{
+		name: "field type changed",
+		schema: `syntax = "proto3";
+package events;
+import "common.proto";
+message Event {
+  string id = 1;
+  string count = 2;
+  Status status = 3;
+  common.Meta meta = 4;
+  oneof payload {
+    string text = 5;
+    bytes blob = 6;
+  }
+}
+enum Status {
+  UNKNOWN = 0;
+  RAISED = 1;
+  CLEARED = 2;
+}
+`,
+		expected:     []ProtobufDifferenceType{FieldScalarKindChanged},
+		incompatible: true,
+	},
+	{
+		name: "field number changed",
+		schema: `syntax = "proto3";
+package events;
+import "common.proto";
+message Event {
+  string id = 1;
+  int32 count = 8;
+  Status status = 3;
+  common.Meta meta = 4;
+  oneof payload {
+    string text = 5;
+    bytes blob = 6;
+  }
+}
+enum Status {
+  UNKNOWN = 0;
+  RAISED = 1;
+  CLEARED = 2;
+}
+`,
+		expected:     []ProtobufDifferenceType{FieldRemoved, FieldAdded},
+		incompatible: true,
+	}, {
+		name: "field number changed, lenient",
+		schema: `syntax = "proto3";
+package events;
+import "common.proto";
+message Event {
+  string id = 1;
+  int32 count = 8;
+  Status status = 3;
+  common.Meta meta = 4;
+  oneof payload {
+    string text = 5;
+    bytes blob = 6;
+  }
+}
+enum Status {
+  UNKNOWN = 0;
+  RAISED = 1;
+  CLEARED = 2;
+}
+`,
+		expected: []ProtobufDifferenceType{FieldRemoved, FieldAdded},
+		lenient:  true,
+	},
+	{
+		name: "removed field reserved",
+		schema: `syntax = "proto3";
+package events;
+import "common.proto";
+message Event {
+  reserved 2;
+  string id = 1;
+  Status status = 3;
+  common.Meta meta = 4;
+  oneof payload {
+    string text = 5;
+    bytes blob = 6;
+  }
+}
+enum Status {
+  UNKNOWN = 0;
+  RAISED = 1;
+  CLEARED = 2;
+}
+`,
+		expected: []ProtobufDifferenceType{FieldRemoved},
+	},
+	{
+		name: "enum value renamed",
+		schema: `syntax = "proto3";
+package events;
+import "common.proto";
+message Event {
+  string id = 1;
+  int32 count = 2;
+  Status status = 3;
+  common.Meta meta = 4;
+  oneof payload {
+    string text = 5;
+    bytes blob = 6;
+  }
+}
+enum Status {
+  UNKNOWN = 0;
+  OPEN = 1;
+  CLEARED = 2;
+}
+`,
+		expected:     []ProtobufDifferenceType{EnumConstChanged},
+		incompatible: true,
+	}, {
+		name: "enum value renamed, lenient",
+		schema: `syntax = "proto3";
+package events;
+import "common.proto";
+message Event {
+  string id = 1;
+  int32 count = 2;
+  Status status = 3;
+  common.Meta meta = 4;
+  oneof payload {
+    string text = 5;
+    bytes blob = 6;
+  }
+}
+enum Status {
+  UNKNOWN = 0;
+  OPEN = 1;
+  CLEARED = 2;
+}
+`,
+		expected: []ProtobufDifferenceType{EnumConstChanged},
+		lenient:  true,
+	},
+	{
+		name: "message renamed",
+		schema: `syntax = "proto3";
+package events;
+import "common.proto";
+message Alert {
+  string id = 1;
+  int32 count = 2;
+  Status status = 3;
+  common.Meta meta = 4;
+  oneof payload {
+    string text = 5;
+    bytes blob = 6;
+  }
+}
+enum Status {
+  UNKNOWN = 0;
+  RAISED = 1;
+  CLEARED = 2;
+}
+`,
+		expected:     []ProtobufDifferenceType{MessageRemoved, MessageAdded},
+		incompatible: true,
+	},
+	{
+		name: "package renamed",
+		schema: `syntax = "proto3";
+package alerts;
+import "common.proto";
+message Event {
+  string id = 1;
+  int32 count = 2;
+  Status status = 3;
+  common.Meta meta = 4;
+  oneof payload {
+    string text = 5;
+    bytes blob = 6;
+  }
+}
+enum Status {
+  UNKNOWN = 0;
+  RAISED = 1;
+  CLEARED = 2;
+}
+`,
+		expected:     []ProtobufDifferenceType{PackageChanged},
+		incompatible: true,
+	},
+	{
+		name: "oneof field removed",
+		schema: `syntax = "proto3";
+package events;
+import "common.proto";
+message Event {
+  string id = 1;
+  int32 count = 2;
+  Status status = 3;
+  common.Meta meta = 4;
+  oneof payload {
+    string text = 5;
+  }
+  bytes blob = 6;
+}
+enum Status {
+  UNKNOWN = 0;
+  RAISED = 1;
+  CLEARED = 2;
+}
+`,
+		expected:     []ProtobufDifferenceType{OneofFieldRemoved},
+		incompatible: true,
+	},
+}
+
+func TestCheckProtobufCompatibility(t *testing.T) {
+	imports := map[string]string{"common.proto": protobufCommon}
+	previous := ProtobufSchema{Schema: protobufBase, Imports: imports}
+	for _, tc := range testProtobufChanges {
+		current := ProtobufSchema{Schema: tc.schema, Imports: imports}
+		diffs, err := CheckProtobufCompatibility(previous, current, tc.lenient)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if len(diffs) != len(tc.expected) {
+			t.Errorf("%s: got differences %v, wanted %v", tc.name, diffs, tc.expected)
+			continue
+		}
+		for i, d := range diffs {
+			if d.Type != tc.expected[i] {
+				t.Errorf("%s: got difference %v, wanted %v", tc.name, d, tc.expected[i])
+			}
+		}
+		if IsProtobufCompatible(diffs) == tc.incompatible {
+			t.Errorf("%s: got compatible=%v, wanted %v", tc.name, !tc.incompatible, tc.incompatible)
+		}
+	}
+}
+
+func TestCheckProtobufCompatibilityParseError(t *testing.T) {
+	previous := ProtobufSchema{Schema: protobufBase}
+	current := ProtobufSchema{Schema: protobufBase}
+	if _, err := CheckProtobufCompatibility(previous, current, false); err == nil {
+		t.Error("expected an error for an unresolved import")
+	}
+}
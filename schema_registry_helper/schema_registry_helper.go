@@ -2,11 +2,13 @@ package schema_registry_helper
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
@@ -24,15 +26,84 @@ import (
 // deserialize data.
 type SchemaRegistryClient struct {
 	schemaRegistryURL      string
+	schemaContext          string
+	requestContext         context.Context
 	credentials            *credentials
 	httpClient             *http.Client
+	instrumentation        Instrumentation
+	retries                int
+	retryBackoff           time.Duration
 	cachingEnabled         bool
+	diskCache              *diskCache
 	idSchemaCache          map[int]*Schema
-	idSchemaCacheLock      sync.RWMutex
+	guidSchemaCache        map[string]*Schema
+	idSchemaCacheLock      *sync.RWMutex
 	subjectSchemaCache     map[string]*Schema
-	subjectSchemaCacheLock sync.RWMutex
+	subjectSchemaCacheLock *sync.RWMutex
+	usageCacheTTL          time.Duration
+	idSubjectsCache        map[int]usageEntry[string]
+	idVersionsCache        map[int]usageEntry[SubjectVersion]
+	idUsageCacheLock       *sync.RWMutex
+	referencedByCache      map[string]usageEntry[int]
+	referencedByCacheLock  *sync.RWMutex
 }
 
+// defaultUsageCacheTTL is how long reverse lookups are cached. Which
+// subjects use a schema changes as versions are registered and deleted
+// elsewhere, so unlike schemas these results expire.
+const defaultUsageCacheTTL = time.Minute
+
+// usageEntry is a cached reverse lookup result.
+type usageEntry[T any] struct {
+	values  []T
+	fetched time.Time
+}
+
+// newUsageEntry caches a copy of values, which are also returned to the
+// caller.
+func newUsageEntry[T any](values []T) usageEntry[T] {
+	entry := usageEntry[T]{values: make([]T, len(values)), fetched: time.Now()}
+	copy(entry.values, values)
+	return entry
+}
+
+// cachedUsage returns a copy of the cached values for key, so that callers
+// cannot change the cache, unless they are missing or expired.
+func cachedUsage[K comparable, T any](cache map[K]usageEntry[T], key K, ttl time.Duration) ([]T, bool) {
+	entry, ok := cache[key]
+	if !ok || time.Since(entry.fetched) >= ttl {
+		return nil, false
+	}
+	values := make([]T, len(entry.values))
+	copy(values, entry.values)
+	return values, true
+}
+
+// SchemaRegistry is the set of registry operations used by the helpers
+// in this package. SchemaRegistryClient implements it over HTTP and
+// MemorySchemaRegistry implements it in memory, so code that depends on
+// the interface can be unit tested without a registry. Client settings
+// such as credentials, timeouts and caching are not part of it.
+type SchemaRegistry interface {
+	GetSchema(schemaID int) (*Schema, error)
+	GetSubjectsBySchemaID(schemaID int) ([]string, error)
+	GetVersionsBySchemaID(schemaID int) ([]SubjectVersion, error)
+	GetReferencedBy(subject string, version int, isKey bool) ([]int, error)
+	GetLatestSchema(subject string, isKey bool) (*Schema, error)
+	GetSchemaVersions(subject string, isKey bool) ([]int, error)
+	GetSchemaByVersion(subject string, version int, isKey bool) (*Schema, error)
+	CheckSchema(subject, schema string, schemaType SchemaType, isKey bool, references ...Reference) (*SchemaResponse, error)
+	CreateSchema(subject, schema string, schemaType SchemaType, isKey bool, references ...Reference) (*Schema, error)
+	GetLatestSchemaWithMetadata(subject string, metadata map[string]string, isKey bool) (*Schema, error)
+	CheckSchemaWithRules(subject, schema string, schemaType SchemaType, isKey bool,
+		metadata *Metadata, ruleSet *RuleSet, references ...Reference) (*SchemaResponse, error)
+	CreateSchemaWithRules(subject, schema string, schemaType SchemaType, isKey bool,
+		metadata *Metadata, ruleSet *RuleSet, references ...Reference) (*Schema, error)
+	GetContexts() ([]string, error)
+}
+
+var _ SchemaRegistry = (*SchemaRegistryClient)(nil)
+
 // Schema references use the import statement of Protobuf and
 // the $ref field of JSON Schema. They are defined by the name
 // of the import or $ref and the associated subject in the registry.
@@ -45,9 +116,12 @@ type Reference struct {
 // Schema is a data structure that holds all
 // the relevant information about schemas.
 type Schema struct {
-	id      int
-	schema  string
-	version int
+	id       int
+	guid     string
+	schema   string
+	version  int
+	metadata *Metadata
+	ruleSet  *RuleSet
 }
 
 // Used if we are connecting to Confluent Cloud
@@ -60,13 +134,26 @@ type schemaRequest struct {
 	Schema     string      `json:"schema"`
 	SchemaType string      `json:"schemaType"`
 	References []Reference `json:"references"`
+	Metadata   *Metadata   `json:"metadata,omitempty"`
+	RuleSet    *RuleSet    `json:"ruleSet,omitempty"`
 }
 
-type schemaResponse struct {
+// SubjectVersion identifies a single version of a subject.
+type SubjectVersion struct {
 	Subject string `json:"subject"`
 	Version int    `json:"version"`
-	Schema  string `json:"schema"`
-	ID      int    `json:"id"`
+}
+
+// SchemaResponse is the registry's description of a registered schema,
+// as returned by CheckSchema.
+type SchemaResponse struct {
+	Subject  string    `json:"subject"`
+	Version  int       `json:"version"`
+	Schema   string    `json:"schema"`
+	ID       int       `json:"id"`
+	GUID     string    `json:"guid,omitempty"`
+	Metadata *Metadata `json:"metadata,omitempty"`
+	RuleSet  *RuleSet  `json:"ruleSet,omitempty"`
 }
 
 type SchemaType string
@@ -80,24 +167,47 @@ const (
 	Avro             SchemaType = "AVRO"
 	Json             SchemaType = "JSON"
 	schemaByID                  = "/schemas/ids/%d"
+	schemaByGUID                = "/schemas/guids/%s"
+	subjectsByID                = "/schemas/ids/%d/subjects"
+	versionsByID                = "/schemas/ids/%d/versions"
 	subjectCheck                = "/subjects/%s"
 	subjectVersions             = "/subjects/%s/versions"
 	subjectByVersion            = "/subjects/%s/versions/%s"
+	subjectMetadata             = "/subjects/%s/metadata"
+	referencedBy                = "/subjects/%s/versions/%d/referencedby"
+	contexts                    = "/contexts"
 	contentType                 = "application/vnd.schemaregistry.v1+json"
 )
 
 var ErrNotFound = "404 Not Found"
 
+// DefaultContext is the context used by subjects that are not qualified
+// with one.
+const DefaultContext = "."
+
+// Context-qualified subjects take the form ":.context:subject".
+const contextDelimiter = ":"
+
 // CreateSchemaRegistryClient creates a client that allows
 // interactions with Schema Registry over HTTP. Applications
 // using this client can retrieve data about schemas, which
 // in turn can be used to serialize and deserialize records.
 func CreateSchemaRegistryClient(schemaRegistryURL string) *SchemaRegistryClient {
 	return &SchemaRegistryClient{schemaRegistryURL: schemaRegistryURL,
-		httpClient:         &http.Client{Timeout: 5 * time.Second},
-		cachingEnabled:     true,
-		idSchemaCache:      make(map[int]*Schema),
-		subjectSchemaCache: make(map[string]*Schema)}
+		httpClient:             &http.Client{Timeout: 5 * time.Second},
+		instrumentation:        NopInstrumentation{},
+		cachingEnabled:         true,
+		usageCacheTTL:          defaultUsageCacheTTL,
+		idSchemaCache:          make(map[int]*Schema),
+		guidSchemaCache:        make(map[string]*Schema),
+		subjectSchemaCache:     make(map[string]*Schema),
+		idSubjectsCache:        make(map[int]usageEntry[string]),
+		idVersionsCache:        make(map[int]usageEntry[SubjectVersion]),
+		referencedByCache:      make(map[string]usageEntry[int]),
+		idSchemaCacheLock:      &sync.RWMutex{},
+		subjectSchemaCacheLock: &sync.RWMutex{},
+		idUsageCacheLock:       &sync.RWMutex{},
+		referencedByCacheLock:  &sync.RWMutex{}}
 }
 
 // GetSchema gets the schema associated with the given id.
@@ -107,25 +217,45 @@ func (client *SchemaRegistryClient) GetSchema(schemaID int) (*Schema, error) {
 		client.idSchemaCacheLock.RLock()
 		cachedSchema := client.idSchemaCache[schemaID]
 		client.idSchemaCacheLock.RUnlock()
+		client.instrumentation.CacheAccessed(IDSchemaCache, cachedSchema != nil)
 		if cachedSchema != nil {
 			return cachedSchema, nil
 		}
 	}
 
-	resp, err := client.httpRequest("GET", fmt.Sprintf(schemaByID, schemaID), nil)
+	if client.cachingEnabled {
+		if schema := client.readDiskSchema(client.diskIDPath(schemaID)); schema != nil {
+			client.idSchemaCacheLock.Lock()
+			client.idSchemaCache[schemaID] = schema
+			client.idSchemaCacheLock.Unlock()
+			return schema, nil
+		}
+	}
+
+	resp, err := client.httpRequest("GET", client.schemaIDPath(schemaByID, schemaID), nil)
 	if err != nil {
+		if !unreachable(err) {
+			return nil, err
+		}
+		if schema := client.readDiskSchema(client.diskIDPath(schemaID)); schema != nil {
+			return schema, nil
+		}
 		return nil, err
 	}
 
-	var schemaResp = new(schemaResponse)
+	var schemaResp = new(SchemaResponse)
 	err = json.Unmarshal(resp, &schemaResp)
 	if err != nil {
 		return nil, err
 	}
 	var schema = &Schema{
-		id:     schemaID,
-		schema: schemaResp.Schema,
+		id:       schemaID,
+		guid:     schemaResp.GUID,
+		schema:   schemaResp.Schema,
+		metadata: schemaResp.Metadata,
+		ruleSet:  schemaResp.RuleSet,
 	}
+	client.writeDiskSchema(schema, client.diskIDPath(schemaID))
 
 	if client.cachingEnabled {
 		client.idSchemaCacheLock.Lock()
@@ -136,6 +266,151 @@ func (client *SchemaRegistryClient) GetSchema(schemaID int) (*Schema, error) {
 	return schema, nil
 }
 
+// GetSchemaByGUID gets the schema with the given GUID, as carried in the
+// schema ID headers written by newer Confluent clients.
+func (client *SchemaRegistryClient) GetSchemaByGUID(guid string) (*Schema, error) {
+
+	if client.cachingEnabled {
+		client.idSchemaCacheLock.RLock()
+		cachedSchema := client.guidSchemaCache[guid]
+		client.idSchemaCacheLock.RUnlock()
+		client.instrumentation.CacheAccessed(IDSchemaCache, cachedSchema != nil)
+		if cachedSchema != nil {
+			return cachedSchema, nil
+		}
+	}
+
+	resp, err := client.httpRequest("GET", fmt.Sprintf(schemaByGUID, url.PathEscape(guid)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var schemaResp = new(SchemaResponse)
+	err = json.Unmarshal(resp, &schemaResp)
+	if err != nil {
+		return nil, err
+	}
+	var schema = &Schema{
+		id:       schemaResp.ID,
+		guid:     guid,
+		schema:   schemaResp.Schema,
+		metadata: schemaResp.Metadata,
+		ruleSet:  schemaResp.RuleSet,
+	}
+
+	if client.cachingEnabled {
+		client.idSchemaCacheLock.Lock()
+		client.guidSchemaCache[guid] = schema
+		client.idSchemaCacheLock.Unlock()
+	}
+
+	return schema, nil
+}
+
+// GetSubjectsBySchemaID returns the subjects that have registered the
+// schema with the given id.
+func (client *SchemaRegistryClient) GetSubjectsBySchemaID(schemaID int) ([]string, error) {
+
+	if client.cachingEnabled {
+		client.idUsageCacheLock.RLock()
+		cachedSubjects, ok := cachedUsage(client.idSubjectsCache, schemaID, client.usageCacheTTL)
+		client.idUsageCacheLock.RUnlock()
+		client.instrumentation.CacheAccessed(IDSubjectsCache, ok)
+		if ok {
+			return cachedSubjects, nil
+		}
+	}
+
+	resp, err := client.httpRequest("GET", client.schemaIDPath(subjectsByID, schemaID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var subjects = []string{}
+	err = json.Unmarshal(resp, &subjects)
+	if err != nil {
+		return nil, err
+	}
+
+	if client.cachingEnabled {
+		client.idUsageCacheLock.Lock()
+		client.idSubjectsCache[schemaID] = newUsageEntry(subjects)
+		client.idUsageCacheLock.Unlock()
+	}
+
+	return subjects, nil
+}
+
+// GetVersionsBySchemaID returns every subject version that uses the
+// schema with the given id.
+func (client *SchemaRegistryClient) GetVersionsBySchemaID(schemaID int) ([]SubjectVersion, error) {
+
+	if client.cachingEnabled {
+		client.idUsageCacheLock.RLock()
+		cachedVersions, ok := cachedUsage(client.idVersionsCache, schemaID, client.usageCacheTTL)
+		client.idUsageCacheLock.RUnlock()
+		client.instrumentation.CacheAccessed(IDVersionsCache, ok)
+		if ok {
+			return cachedVersions, nil
+		}
+	}
+
+	resp, err := client.httpRequest("GET", client.schemaIDPath(versionsByID, schemaID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions = []SubjectVersion{}
+	err = json.Unmarshal(resp, &versions)
+	if err != nil {
+		return nil, err
+	}
+
+	if client.cachingEnabled {
+		client.idUsageCacheLock.Lock()
+		client.idVersionsCache[schemaID] = newUsageEntry(versions)
+		client.idUsageCacheLock.Unlock()
+	}
+
+	return versions, nil
+}
+
+// GetReferencedBy returns the ids of the schemas that reference the
+// given version of a subject.
+func (client *SchemaRegistryClient) GetReferencedBy(subject string, version int, isKey bool) ([]int, error) {
+
+	concreteSubject := client.getConcreteSubject(subject, isKey)
+	key := cacheKey(concreteSubject, strconv.Itoa(version))
+	if client.cachingEnabled {
+		client.referencedByCacheLock.RLock()
+		cachedIDs, ok := cachedUsage(client.referencedByCache, key, client.usageCacheTTL)
+		client.referencedByCacheLock.RUnlock()
+		client.instrumentation.CacheAccessed(ReferencedByCache, ok)
+		if ok {
+			return cachedIDs, nil
+		}
+	}
+
+	resp, err := client.httpRequest("GET", fmt.Sprintf(referencedBy, url.PathEscape(concreteSubject), version), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids = []int{}
+	err = json.Unmarshal(resp, &ids)
+	if err != nil {
+		return nil, err
+	}
+
+	if client.cachingEnabled {
+		client.referencedByCacheLock.Lock()
+		client.referencedByCache[key] = newUsageEntry(ids)
+		client.referencedByCacheLock.Unlock()
+	}
+
+	return ids, nil
+}
+
 // GetLatestSchema gets the schema associated with the given subject.
 // The schema returned contains the last version for that subject.
 func (client *SchemaRegistryClient) GetLatestSchema(subject string, isKey bool) (*Schema, error) {
@@ -152,11 +427,47 @@ func (client *SchemaRegistryClient) GetLatestSchema(subject string, isKey bool)
 	return schema, err
 }
 
+// GetLatestSchemaWithMetadata gets the latest version of the given subject
+// whose metadata properties include every key and value in metadata. The
+// result is never cached, for the same reason as GetLatestSchema.
+func (client *SchemaRegistryClient) GetLatestSchemaWithMetadata(subject string,
+	metadata map[string]string, isKey bool) (*Schema, error) {
+
+	concreteSubject := client.getConcreteSubject(subject, isKey)
+	query := url.Values{}
+	for k, v := range metadata {
+		query.Add("key", k)
+		query.Add("value", v)
+	}
+	uri := fmt.Sprintf(subjectMetadata, url.PathEscape(concreteSubject))
+	if len(query) > 0 {
+		uri += "?" + query.Encode()
+	}
+	resp, err := client.httpRequest("GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	schemaResp := new(SchemaResponse)
+	err = json.Unmarshal(resp, &schemaResp)
+	if err != nil {
+		return nil, err
+	}
+	return &Schema{
+		id:       schemaResp.ID,
+		guid:     schemaResp.GUID,
+		schema:   schemaResp.Schema,
+		version:  schemaResp.Version,
+		metadata: schemaResp.Metadata,
+		ruleSet:  schemaResp.RuleSet,
+	}, nil
+}
+
 // GetSchemaVersions returns a list of versions from a given subject.
 func (client *SchemaRegistryClient) GetSchemaVersions(subject string, isKey bool) ([]int, error) {
 
-	concreteSubject := getConcreteSubject(subject, isKey)
-	resp, err := client.httpRequest("GET", fmt.Sprintf(subjectVersions, concreteSubject), nil)
+	concreteSubject := client.getConcreteSubject(subject, isKey)
+	resp, err := client.httpRequest("GET", fmt.Sprintf(subjectVersions, url.PathEscape(concreteSubject)), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -180,20 +491,27 @@ func (client *SchemaRegistryClient) GetSchemaByVersion(subject string, version i
 // with the subject provided. It returns the newly created schema with
 // all its associated information.
 func (client *SchemaRegistryClient) CheckSchema(subject, schema string,
-	schemaType SchemaType, isKey bool, references ...Reference) (*schemaResponse, error) {
+	schemaType SchemaType, isKey bool, references ...Reference) (*SchemaResponse, error) {
+	return client.CheckSchemaWithRules(subject, schema, schemaType, isKey, nil, nil, references...)
+}
 
-	concreteSubject := getConcreteSubject(subject, isKey)
-	payload, err := createPayload(schema, schemaType, references)
+// CheckSchemaWithRules behaves like CheckSchema, but only matches a
+// version registered with the same metadata and rule set.
+func (client *SchemaRegistryClient) CheckSchemaWithRules(subject, schema string, schemaType SchemaType, isKey bool,
+	metadata *Metadata, ruleSet *RuleSet, references ...Reference) (*SchemaResponse, error) {
+
+	concreteSubject := client.getConcreteSubject(subject, isKey)
+	payload, err := createPayload(schema, schemaType, client.qualifyReferences(references), metadata, ruleSet)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := client.httpRequest("POST", fmt.Sprintf(subjectCheck, concreteSubject), payload)
+	resp, err := client.httpRequest("POST", fmt.Sprintf(subjectCheck, url.PathEscape(concreteSubject)), payload)
 	if err != nil {
 		return nil, err
 	}
 
-	schemaResp := new(schemaResponse)
+	schemaResp := new(SchemaResponse)
 	err = json.Unmarshal(resp, &schemaResp)
 	if err != nil {
 		// most likely error is that the schema does not exist
@@ -208,19 +526,26 @@ func (client *SchemaRegistryClient) CheckSchema(subject, schema string,
 // all its associated information.
 func (client *SchemaRegistryClient) CreateSchema(subject, schema string,
 	schemaType SchemaType, isKey bool, references ...Reference) (*Schema, error) {
+	return client.CreateSchemaWithRules(subject, schema, schemaType, isKey, nil, nil, references...)
+}
 
-	concreteSubject := getConcreteSubject(subject, isKey)
-	payload, err := createPayload(schema, schemaType, references)
+// CreateSchemaWithRules behaves like CreateSchema, but registers the
+// schema version with data contract metadata and rules. Either may be nil.
+func (client *SchemaRegistryClient) CreateSchemaWithRules(subject, schema string, schemaType SchemaType, isKey bool,
+	metadata *Metadata, ruleSet *RuleSet, references ...Reference) (*Schema, error) {
+
+	concreteSubject := client.getConcreteSubject(subject, isKey)
+	payload, err := createPayload(schema, schemaType, client.qualifyReferences(references), metadata, ruleSet)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := client.httpRequest("POST", fmt.Sprintf(subjectVersions, concreteSubject), payload)
+	resp, err := client.httpRequest("POST", fmt.Sprintf(subjectVersions, url.PathEscape(concreteSubject)), payload)
 	if err != nil {
 		return nil, err
 	}
 
-	schemaResp := new(schemaResponse)
+	schemaResp := new(SchemaResponse)
 	err = json.Unmarshal(resp, &schemaResp)
 	if err != nil {
 		return nil, err
@@ -251,6 +576,10 @@ func (client *SchemaRegistryClient) CreateSchema(subject, schema string,
 		client.idSchemaCache[newSchema.id] = newSchema
 		client.idSchemaCacheLock.Unlock()
 
+		// The schema may now be used by one more subject, and
+		// anything it references has gained a referrer.
+		client.invalidateUsage(newSchema.id, client.qualifyReferences(references))
+
 	}
 
 	return newSchema, nil
@@ -280,36 +609,139 @@ func (client *SchemaRegistryClient) CachingEnabled(value bool) {
 	client.cachingEnabled = value
 }
 
+// SetUsageCacheTTL sets how long the results of GetSubjectsBySchemaID,
+// GetVersionsBySchemaID and GetReferencedBy are cached. It defaults to one
+// minute; zero stops caching them.
+func (client *SchemaRegistryClient) SetUsageCacheTTL(ttl time.Duration) {
+	client.usageCacheTTL = ttl
+}
+
+// GetContexts lists the contexts known to Schema Registry. The default
+// context is reported as ".".
+func (client *SchemaRegistryClient) GetContexts() ([]string, error) {
+	resp, err := client.httpRequest("GET", contexts, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result = []string{}
+	err = json.Unmarshal(resp, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// WithContext returns a client scoped to the given context, sharing the
+// URL, credentials and HTTP client of this one. Subjects passed to the
+// scoped client are qualified with the context and schema IDs are looked
+// up within it. The scoped client has its own caches, since schema IDs
+// are only unique within a context. Passing "" or DefaultContext returns
+// a client for the default context.
+func (client *SchemaRegistryClient) WithContext(schemaContext string) *SchemaRegistryClient {
+	schemaContext = normalizeContext(schemaContext)
+	if schemaContext == DefaultContext {
+		schemaContext = ""
+	}
+	return &SchemaRegistryClient{schemaRegistryURL: client.schemaRegistryURL,
+		schemaContext:          schemaContext,
+		credentials:            client.credentials,
+		httpClient:             client.httpClient,
+		instrumentation:        client.instrumentation,
+		retries:                client.retries,
+		retryBackoff:           client.retryBackoff,
+		cachingEnabled:         client.cachingEnabled,
+		usageCacheTTL:          client.usageCacheTTL,
+		diskCache:              client.diskCache,
+		requestContext:         client.requestContext,
+		idSchemaCache:          make(map[int]*Schema),
+		guidSchemaCache:        make(map[string]*Schema),
+		subjectSchemaCache:     make(map[string]*Schema),
+		idSubjectsCache:        make(map[int]usageEntry[string]),
+		idVersionsCache:        make(map[int]usageEntry[SubjectVersion]),
+		referencedByCache:      make(map[string]usageEntry[int]),
+		idSchemaCacheLock:      &sync.RWMutex{},
+		subjectSchemaCacheLock: &sync.RWMutex{},
+		idUsageCacheLock:       &sync.RWMutex{},
+		referencedByCacheLock:  &sync.RWMutex{}}
+}
+
+// WithRequestContext returns a client whose requests carry ctx, so that
+// they are cancelled with it and Instrumentation sees it as the request's
+// context, e.g. to inject the caller's trace. The returned client shares
+// the caches and settings of this one, and is cheap enough to create for
+// every call:
+//
+//	schema, err := client.WithRequestContext(ctx).GetLatestSchema(subject, false)
+func (client *SchemaRegistryClient) WithRequestContext(ctx context.Context) *SchemaRegistryClient {
+	scoped := *client
+	scoped.requestContext = ctx
+	return &scoped
+}
+
+// Context returns the context this client is scoped to, or DefaultContext.
+func (client *SchemaRegistryClient) Context() string {
+	if client.schemaContext == "" {
+		return DefaultContext
+	}
+	return client.schemaContext
+}
+
 func (client *SchemaRegistryClient) getVersion(subject string,
 	version string, isKey bool) (*Schema, error) {
 
-	concreteSubject := getConcreteSubject(subject, isKey)
+	concreteSubject := client.getConcreteSubject(subject, isKey)
 
 	if client.cachingEnabled {
 		cacheKey := cacheKey(concreteSubject, version)
 		client.subjectSchemaCacheLock.RLock()
 		cachedResult := client.subjectSchemaCache[cacheKey]
 		client.subjectSchemaCacheLock.RUnlock()
+		client.instrumentation.CacheAccessed(SubjectSchemaCache, cachedResult != nil)
 		if cachedResult != nil {
 			return cachedResult, nil
 		}
 	}
 
-	resp, err := client.httpRequest("GET", fmt.Sprintf(subjectByVersion, concreteSubject, version), nil)
+	// Only a fixed version can be served from disk before asking the
+	// registry; "latest" is read from disk only if the registry fails.
+	diskPath := client.diskVersionPath(concreteSubject, version)
+	if _, err := strconv.Atoi(version); err == nil && client.cachingEnabled {
+		if schema := client.readDiskSchema(diskPath); schema != nil {
+			client.subjectSchemaCacheLock.Lock()
+			client.subjectSchemaCache[cacheKey(concreteSubject, version)] = schema
+			client.subjectSchemaCacheLock.Unlock()
+			return schema, nil
+		}
+	}
+
+	resp, err := client.httpRequest("GET", fmt.Sprintf(subjectByVersion, url.PathEscape(concreteSubject), version), nil)
 	if err != nil {
+		if !unreachable(err) {
+			return nil, err
+		}
+		if schema := client.readDiskSchema(diskPath); schema != nil {
+			return schema, nil
+		}
 		return nil, err
 	}
 
-	schemaResp := new(schemaResponse)
+	schemaResp := new(SchemaResponse)
 	err = json.Unmarshal(resp, &schemaResp)
 	if err != nil {
 		return nil, err
 	}
 	var schema = &Schema{
-		id:      schemaResp.ID,
-		schema:  schemaResp.Schema,
-		version: schemaResp.Version,
+		id:       schemaResp.ID,
+		guid:     schemaResp.GUID,
+		schema:   schemaResp.Schema,
+		version:  schemaResp.Version,
+		metadata: schemaResp.Metadata,
+		ruleSet:  schemaResp.RuleSet,
 	}
+	client.writeDiskSchema(schema, diskPath, client.diskIDPath(schema.id),
+		client.diskVersionPath(concreteSubject, strconv.Itoa(schema.version)))
 
 	if client.cachingEnabled {
 
@@ -329,30 +761,113 @@ func (client *SchemaRegistryClient) getVersion(subject string,
 	return schema, nil
 }
 
+func (client *SchemaRegistryClient) invalidateUsage(schemaID int, references []Reference) {
+	client.idUsageCacheLock.Lock()
+	if _, ok := client.idSubjectsCache[schemaID]; ok {
+		delete(client.idSubjectsCache, schemaID)
+		client.instrumentation.CacheEvicted(IDSubjectsCache, 1)
+	}
+	if _, ok := client.idVersionsCache[schemaID]; ok {
+		delete(client.idVersionsCache, schemaID)
+		client.instrumentation.CacheEvicted(IDVersionsCache, 1)
+	}
+	client.idUsageCacheLock.Unlock()
+
+	client.referencedByCacheLock.Lock()
+	for _, r := range references {
+		key := cacheKey(r.Subject, strconv.Itoa(r.Version))
+		if _, ok := client.referencedByCache[key]; ok {
+			delete(client.referencedByCache, key)
+			client.instrumentation.CacheEvicted(ReferencedByCache, 1)
+		}
+	}
+	client.referencedByCacheLock.Unlock()
+}
+
+// schemaIDPath builds a /schemas/ids/ path. Schema IDs are only unique
+// within a context, so a scoped client tells the registry which one to
+// look in.
+func (client *SchemaRegistryClient) schemaIDPath(format string, schemaID int) string {
+	uri := fmt.Sprintf(format, schemaID)
+	if client.schemaContext != "" {
+		uri += "?subject=" + url.QueryEscape(QualifiedSubject(client.schemaContext, ""))
+	}
+	return uri
+}
+
 func (client *SchemaRegistryClient) httpRequest(method, uri string, payload io.Reader) ([]byte, error) {
 
+	// The payload is buffered so that it can be sent again on a retry.
+	var body []byte
+	if payload != nil {
+		var err error
+		body, err = ioutil.ReadAll(payload)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := client.requestContext
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	endpoint := endpointLabel(uri)
+	for attempt := 0; ; attempt++ {
+		resp, status, err := client.doRequest(ctx, method, uri, endpoint, body)
+		if attempt >= client.retries || !shouldRetry(status, err) || ctx.Err() != nil {
+			return resp, err
+		}
+		client.instrumentation.RequestRetried(endpoint, attempt+1, err)
+		time.Sleep(client.retryBackoff << uint(attempt))
+	}
+}
+
+func (client *SchemaRegistryClient) doRequest(ctx context.Context, method, uri, endpoint string, body []byte) ([]byte, int, error) {
+
 	url := fmt.Sprintf("%s%s", client.schemaRegistryURL, uri)
-	req, err := http.NewRequest(method, url, payload)
+	var payload io.Reader
+	if body != nil {
+		payload = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, payload)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if client.credentials != nil {
 		req.SetBasicAuth(client.credentials.username, client.credentials.password)
 	}
 	req.Header.Set("Content-Type", contentType)
+	done := client.instrumentation.RequestStarted(req, endpoint)
 	resp, err := client.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		done(0, err)
+		return nil, 0, err
 	}
 
 	if resp != nil {
 		defer resp.Body.Close()
 	}
 	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return nil, createError(resp)
+		err = createError(resp)
+		done(resp.StatusCode, err)
+		return nil, resp.StatusCode, err
 	}
 
-	return ioutil.ReadAll(resp.Body)
+	result, err := ioutil.ReadAll(resp.Body)
+	done(resp.StatusCode, err)
+	return result, resp.StatusCode, err
+}
+
+// NewSchema creates a Schema, for SchemaRegistry implementations
+// outside this package.
+func NewSchema(id int, schema string, version int) *Schema {
+	return &Schema{id: id, schema: schema, version: version}
+}
+
+// NewSchemaWithRules creates a Schema that carries data contract metadata
+// and rules.
+func NewSchemaWithRules(id int, schema string, version int, metadata *Metadata, ruleSet *RuleSet) *Schema {
+	return &Schema{id: id, schema: schema, version: version, metadata: metadata, ruleSet: ruleSet}
 }
 
 // ID ensures access to ID
@@ -360,6 +875,12 @@ func (schema *Schema) ID() int {
 	return schema.id
 }
 
+// GUID ensures access to the schema GUID, which registries that support
+// it return alongside the ID. It is empty otherwise.
+func (schema *Schema) GUID() string {
+	return schema.guid
+}
+
 // Schema ensures access to Schema
 func (schema *Schema) Schema() string {
 	return schema.schema
@@ -370,10 +891,87 @@ func (schema *Schema) Version() int {
 	return schema.version
 }
 
+// Metadata ensures access to Metadata. It is nil when the version was
+// registered without any.
+func (schema *Schema) Metadata() *Metadata {
+	return schema.metadata
+}
+
+// RuleSet ensures access to RuleSet. It is nil when the version was
+// registered without any.
+func (schema *Schema) RuleSet() *RuleSet {
+	return schema.ruleSet
+}
+
 func cacheKey(subject string, version string) string {
 	return fmt.Sprintf("%s-%s", subject, version)
 }
 
+// getConcreteSubject adds the key/value suffix to a subject and, for a
+// client scoped to a context, qualifies it with that context. Subjects
+// that are already context-qualified are left in their own context.
+func (client *SchemaRegistryClient) getConcreteSubject(subject string, isKey bool) string {
+	subject = getConcreteSubject(subject, isKey)
+	if client.schemaContext == "" {
+		return subject
+	}
+	return QualifiedSubject(client.schemaContext, subject)
+}
+
+// qualifyReferences places references without an explicit context in the
+// client's context, which is how the registry resolves them as well.
+func (client *SchemaRegistryClient) qualifyReferences(references []Reference) []Reference {
+	if client.schemaContext == "" || len(references) == 0 {
+		return references
+	}
+	qualified := make([]Reference, len(references))
+	for i, r := range references {
+		r.Subject = QualifiedSubject(client.schemaContext, r.Subject)
+		qualified[i] = r
+	}
+	return qualified
+}
+
+// QualifiedSubject returns subject in the form ":.context:subject" used by
+// the registry for subjects outside the default context. A subject that
+// already carries a context is returned unchanged, as is any subject in
+// the default context.
+func QualifiedSubject(schemaContext, subject string) string {
+	if strings.HasPrefix(subject, contextDelimiter+".") {
+		return subject
+	}
+	schemaContext = normalizeContext(schemaContext)
+	if schemaContext == DefaultContext {
+		return subject
+	}
+	return contextDelimiter + schemaContext + contextDelimiter + subject
+}
+
+// SplitQualifiedSubject is the inverse of QualifiedSubject. Subjects with
+// no context qualifier are reported in DefaultContext.
+func SplitQualifiedSubject(subject string) (string, string) {
+	if !strings.HasPrefix(subject, contextDelimiter+".") {
+		return DefaultContext, subject
+	}
+	rest := subject[len(contextDelimiter):]
+	end := strings.Index(rest, contextDelimiter)
+	if end < 0 {
+		return rest, ""
+	}
+	return rest[:end], rest[end+len(contextDelimiter):]
+}
+
+// normalizeContext accepts context names with or without the leading dot.
+func normalizeContext(schemaContext string) string {
+	if schemaContext == "" {
+		return DefaultContext
+	}
+	if !strings.HasPrefix(schemaContext, ".") {
+		schemaContext = "." + schemaContext
+	}
+	return schemaContext
+}
+
 func getConcreteSubject(subject string, isKey bool) string {
 	if isKey {
 		subject = fmt.Sprintf("%s-key", subject)
@@ -383,20 +981,41 @@ func getConcreteSubject(subject string, isKey bool) string {
 	return subject
 }
 
+// RegistryError is an error response from Schema Registry. Its message
+// starts with the HTTP status, so it can still be matched against
+// ErrNotFound.
+type RegistryError struct {
+	StatusCode int
+	Status     string
+	// ErrorCode is the registry's error_code, such as 40401 for a subject
+	// that does not exist, or 0 if the response had none.
+	ErrorCode int
+	Message   string
+}
+
+func (e *RegistryError) Error() string {
+	if e.ErrorCode == 0 && e.Message == "" {
+		return e.Status
+	}
+	return fmt.Sprintf("%s: %s", e.Status, e.Message)
+}
+
 func createError(resp *http.Response) error {
 	decoder := json.NewDecoder(resp.Body)
 	var errorResp struct {
 		ErrorCode int    `json:"error_code"`
 		Message   string `json:"message"`
 	}
-	err := decoder.Decode(&errorResp)
-	if err == nil {
-		return fmt.Errorf("%s: %s", resp.Status, errorResp.Message)
+	registryError := &RegistryError{StatusCode: resp.StatusCode, Status: resp.Status}
+	if decoder.Decode(&errorResp) == nil {
+		registryError.ErrorCode = errorResp.ErrorCode
+		registryError.Message = errorResp.Message
 	}
-	return fmt.Errorf("%s", resp.Status)
+	return registryError
 }
 
-func createPayload(schema string, schemaType SchemaType, references []Reference) (*bytes.Buffer, error) {
+func createPayload(schema string, schemaType SchemaType, references []Reference,
+	metadata *Metadata, ruleSet *RuleSet) (*bytes.Buffer, error) {
 
 	if schemaType != Protobuf {
 		compiledRegex := regexp.MustCompile(`\r?\n`)
@@ -407,7 +1026,8 @@ func createPayload(schema string, schemaType SchemaType, references []Reference)
 		references = make([]Reference, 0)
 	}
 
-	schemaReq := schemaRequest{Schema: schema, SchemaType: schemaType.String(), References: references}
+	schemaReq := schemaRequest{Schema: schema, SchemaType: schemaType.String(), References: references,
+		Metadata: metadata, RuleSet: ruleSet}
 	schemaBytes, err := json.Marshal(schemaReq)
 	if err != nil {
 		return bytes.NewBuffer(nil), err
@@ -418,12 +1038,19 @@ func createPayload(schema string, schemaType SchemaType, references []Reference)
 // Export a schema to an existing schema_registry_helper schema registry
 // First, will check to see if the same schema already exists. If it does, it will return that schema's version
 // If it does not, a new schema will be created - and then that schema version number will be returned
-func ExportSchema(schemaBytes []byte, topic string, schemaType SchemaType, src SchemaRegistryClient) (int, error) {
-	schema, err := src.CheckSchema(topic, string(schemaBytes), schemaType, false)
+func ExportSchema(schemaBytes []byte, topic string, schemaType SchemaType, src SchemaRegistry) (int, error) {
+	return ExportSchemaWithRules(schemaBytes, topic, schemaType, nil, nil, src)
+}
+
+// ExportSchemaWithRules behaves like ExportSchema, but the schema version is
+// matched and registered together with its data contract metadata and rules
+func ExportSchemaWithRules(schemaBytes []byte, topic string, schemaType SchemaType,
+	metadata *Metadata, ruleSet *RuleSet, src SchemaRegistry) (int, error) {
+	schema, err := src.CheckSchemaWithRules(topic, string(schemaBytes), schemaType, false, metadata, ruleSet)
 	if err != nil && !strings.Contains(err.Error(), ErrNotFound) {
 		return -1, err
 	} else if err != nil { // A specific error returns from the API if the schema does not exist. In this case, create a new schema
-		schema, err := src.CreateSchema(topic, string(schemaBytes), schemaType, false)
+		schema, err := src.CreateSchemaWithRules(topic, string(schemaBytes), schemaType, false, metadata, ruleSet)
 		if err != nil {
 			return -1, err
 		}
@@ -0,0 +1,156 @@
+package schema_registry_helper
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testQualifiedSubjects = []struct {
+	context   string
+	subject   string
+	qualified string
+}{
+	{context: "", subject: "topic-value", qualified: "topic-value"},
+	{context: ".", subject: "topic-value", qualified: "topic-value"},
+	{context: "tenant", subject: "topic-value", qualified: ":.tenant:topic-value"},
+	{context: ".tenant", subject: "topic-value", qualified: ":.tenant:topic-value"},
+	{context: "tenant", subject: ":.other:topic-value", qualified: ":.other:topic-value"},
+}
+
+func TestQualifiedSubject(t *testing.T) {
+	for _, tc := range testQualifiedSubjects {
+		s := QualifiedSubject(tc.context, tc.subject)
+		if s != tc.qualified {
+			t.Errorf("got %q, wanted %q", s, tc.qualified)
+		}
+	}
+}
+
+func TestSplitQualifiedSubject(t *testing.T) {
+	c, s := SplitQualifiedSubject(":.tenant:topic-value")
+	if c != ".tenant" || s != "topic-value" {
+		t.Errorf("got %q %q", c, s)
+	}
+	c, s = SplitQualifiedSubject("topic-value")
+	if c != DefaultContext || s != "topic-value" {
+		t.Errorf("got %q %q", c, s)
+	}
+}
+
+func TestClientWithContext(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath()+"?"+r.URL.RawQuery)
+		switch r.URL.Path {
+		case "/contexts":
+			json.NewEncoder(w).Encode([]string{".", ".tenant"})
+		case "/schemas/ids/1":
+			json.NewEncoder(w).Encode(SchemaResponse{Schema: "{}"})
+		default:
+			json.NewEncoder(w).Encode([]int{1, 2})
+		}
+	}))
+	defer server.Close()
+
+	client := CreateSchemaRegistryClient(server.URL)
+	contexts, err := client.GetContexts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contexts) != 2 || contexts[1] != ".tenant" {
+		t.Errorf("got contexts %v", contexts)
+	}
+
+	scoped := client.WithContext("tenant")
+	if scoped.Context() != ".tenant" {
+		t.Errorf("got context %q", scoped.Context())
+	}
+	if _, err := scoped.GetSchemaVersions("topic", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scoped.GetSchema(1); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"/contexts?",
+		"/subjects/:.tenant:topic-value/versions?",
+		"/schemas/ids/1?subject=%3A.tenant%3A",
+	}
+	if len(paths) != len(expected) {
+		t.Fatalf("got requests %v, wanted %v", paths, expected)
+	}
+	for i := range expected {
+		if paths[i] != expected[i] {
+			t.Errorf("got request %q, wanted %q", paths[i], expected[i])
+		}
+	}
+}
+
+func TestReverseLookup(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/schemas/ids/7/subjects":
+			json.NewEncoder(w).Encode([]string{"topic-value"})
+		case "/schemas/ids/7/versions":
+			json.NewEncoder(w).Encode([]SubjectVersion{{Subject: "topic-value", Version: 3}})
+		case "/subjects/common-value/versions/1/referencedby":
+			json.NewEncoder(w).Encode([]int{7, 9})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := CreateSchemaRegistryClient(server.URL)
+	for i := 0; i < 2; i++ {
+		subjects, err := client.GetSubjectsBySchemaID(7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(subjects) != 1 || subjects[0] != "topic-value" {
+			t.Errorf("got subjects %v", subjects)
+		}
+		versions, err := client.GetVersionsBySchemaID(7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(versions) != 1 || versions[0].Version != 3 {
+			t.Errorf("got versions %v", versions)
+		}
+		ids, err := client.GetReferencedBy("common", 1, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != 2 || ids[1] != 9 {
+			t.Errorf("got ids %v", ids)
+		}
+		// Changing the results must not change the cache.
+		subjects[0], versions[0].Version, ids[1] = "changed", 0, 0
+	}
+	if requests != 3 {
+		t.Errorf("got %d requests, wanted 3 with caching", requests)
+	}
+
+	requests = 0
+	client.SetUsageCacheTTL(10 * time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	client.GetSubjectsBySchemaID(7)
+	client.GetSubjectsBySchemaID(7)
+	if requests != 1 {
+		t.Errorf("got %d requests, wanted 1 after the cache expired", requests)
+	}
+
+	requests = 0
+	client.SetUsageCacheTTL(0)
+	client.GetReferencedBy("common", 1, false)
+	client.GetReferencedBy("common", 1, false)
+	if requests != 2 {
+		t.Errorf("got %d requests, wanted 2 without caching", requests)
+	}
+}
@@ -0,0 +1,47 @@
+package schema_registry_helper
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var protobufSyntax = regexp.MustCompile(`(?m)^\s*(syntax|edition)\s*=\s*"[^"]*"\s*;`)
+
+// DetectSchemaType returns the type of a schema file. The extension
+// decides when it is one of .avsc, .proto, .jsonschema or .json.
+// Otherwise the content is inspected: a Protobuf syntax or edition
+// statement means PROTOBUF, and a JSON document that looks like an Avro
+// record, enum, fixed or union means AVRO. Anything else is JSON.
+func DetectSchemaType(fileName string, content []byte) SchemaType {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".avsc":
+		return Avro
+	case ".proto":
+		return Protobuf
+	case ".jsonschema", ".json":
+		return Json
+	}
+
+	trimmed := bytes.TrimSpace(content)
+	if protobufSyntax.Match(trimmed) {
+		return Protobuf
+	}
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		return Avro
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(trimmed, &object); err != nil {
+		return Json
+	}
+	if _, ok := object["$schema"]; ok {
+		return Json
+	}
+	switch object["type"] {
+	case "record", "enum", "fixed":
+		return Avro
+	}
+	return Json
+}
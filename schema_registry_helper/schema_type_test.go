@@ -0,0 +1,27 @@
+package schema_registry_helper
+
+import "testing"
+
+var testSchemaTypes = []struct {
+	fileName string
+	content  string
+	want     SchemaType
+}{
+	{fileName: "user.avsc", content: `{}`, want: Avro},
+	{fileName: "user.proto", content: ``, want: Protobuf},
+	{fileName: "user.jsonschema", content: `{"type": "record"}`, want: Json},
+	{fileName: "user", content: "// comment\nsyntax = \"proto3\";\nmessage User {}", want: Protobuf},
+	{fileName: "user", content: `{"type": "record", "name": "User", "fields": []}`, want: Avro},
+	{fileName: "user", content: `["null", "string"]`, want: Avro},
+	{fileName: "user", content: `{"$schema": "http://json-schema.org/draft-07/schema#", "type": "object"}`, want: Json},
+	{fileName: "user", content: `{"type": "object"}`, want: Json},
+	{fileName: "user", content: `not a schema`, want: Json},
+}
+
+func TestDetectSchemaType(t *testing.T) {
+	for _, tc := range testSchemaTypes {
+		if got := DetectSchemaType(tc.fileName, []byte(tc.content)); got != tc.want {
+			t.Errorf("%s %q: got %s, wanted %s", tc.fileName, tc.content, got, tc.want)
+		}
+	}
+}
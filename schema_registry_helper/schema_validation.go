@@ -0,0 +1,417 @@
+package schema_registry_helper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/bufbuild/protocompile/reporter"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// SchemaError is a problem found in a schema by ValidateSchema. Line and
+// Column start at 1, and are 0 when the problem has no position.
+type SchemaError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e SchemaError) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// jsonSchemaDrafts are the $schema values ValidateSchema knows the
+// meta-schema of, without the scheme and trailing "#".
+var jsonSchemaDrafts = map[string]bool{
+	"json-schema.org/draft-04/schema":      true,
+	"json-schema.org/draft-06/schema":      true,
+	"json-schema.org/draft-07/schema":      true,
+	"json-schema.org/draft/2019-09/schema": true,
+	"json-schema.org/draft/2020-12/schema": true,
+}
+
+// ValidateSchema checks that content is a well-formed schema of the given
+// type and returns every problem found. JSON schemas are checked against
+// the meta-schema of the draft named by their $schema, or draft-07 if
+// they have none. Avro schemas are checked against the Avro specification:
+// types, names, fields, symbols and references to named types. Protobuf
+// schemas are compiled; fileName is the name they are compiled under, and
+// their imports are looked up in importPaths and the well-known types.
+func ValidateSchema(schemaType SchemaType, fileName string, content []byte, importPaths []string) []SchemaError {
+	switch schemaType {
+	case Protobuf:
+		return validateProtobuf(fileName, content, importPaths)
+	case Avro:
+		return validateAvro(content)
+	default:
+		return validateJSONSchema(content)
+	}
+}
+
+func validateJSONSchema(content []byte) []SchemaError {
+	doc, offsets, errs := parseJSON(content)
+	if errs != nil {
+		return errs
+	}
+	if object, ok := doc.(map[string]interface{}); ok {
+		if draft, ok := object["$schema"].(string); ok {
+			key := strings.TrimSuffix(strings.TrimSuffix(draft, "#"), "/")
+			key = strings.TrimPrefix(strings.TrimPrefix(key, "http://"), "https://")
+			if !jsonSchemaDrafts[key] {
+				return []SchemaError{offsets.errorf("/$schema", "unsupported $schema %q", draft)}
+			}
+		}
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft7
+	// References to other schemas are not followed; only this schema is
+	// checked.
+	compiler.LoadURL = func(string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("{}")), nil
+	}
+	const url = "file:///schema.json"
+	if err := compiler.AddResource(url, bytes.NewReader(content)); err != nil {
+		return []SchemaError{{Message: err.Error()}}
+	}
+	_, err := compiler.Compile(url)
+	if err == nil {
+		return nil
+	}
+	var validationError *jsonschema.ValidationError
+	if schemaError, ok := err.(*jsonschema.SchemaError); ok {
+		validationError, _ = schemaError.Err.(*jsonschema.ValidationError)
+	}
+	if validationError == nil {
+		return []SchemaError{{Message: strings.TrimPrefix(err.Error(), "jsonschema: ")}}
+	}
+	var found []SchemaError
+	var leaves func(e *jsonschema.ValidationError)
+	leaves = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			found = append(found, offsets.errorf(e.InstanceLocation, "%s", e.Message))
+		}
+		for _, cause := range e.Causes {
+			leaves(cause)
+		}
+	}
+	leaves(validationError)
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].Line != found[j].Line {
+			return found[i].Line < found[j].Line
+		}
+		return found[i].Column < found[j].Column
+	})
+	return found
+}
+
+// jsonOffsets maps the JSON pointer of every value in a document to the
+// position of its first byte.
+type jsonOffsets struct {
+	content []byte
+	offsets map[string]int
+}
+
+// parseJSON decodes content, numbers as json.Number, and records where
+// each value starts.
+func parseJSON(content []byte) (interface{}, *jsonOffsets, []SchemaError) {
+	offsets := &jsonOffsets{content: content, offsets: make(map[string]int)}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var doc interface{}
+	err := decoder.Decode(&doc)
+	if err == nil {
+		if _, tokenErr := decoder.Token(); tokenErr != io.EOF {
+			err = fmt.Errorf("unexpected content after the schema")
+			if syntaxError, ok := tokenErr.(*json.SyntaxError); ok {
+				err = syntaxError
+			}
+		}
+	}
+	if err != nil {
+		if syntaxError, ok := err.(*json.SyntaxError); ok {
+			// The offset is just after the character that was not expected.
+			return nil, nil, []SchemaError{offsets.errorAt(int(syntaxError.Offset)-1, "%v", err)}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, nil, []SchemaError{offsets.errorAt(len(content), "unexpected end of JSON input")}
+		}
+		return nil, nil, []SchemaError{offsets.errorAt(int(decoder.InputOffset()), "%v", err)}
+	}
+	offsets.record(json.NewDecoder(bytes.NewReader(content)), "")
+	return doc, offsets, nil
+}
+
+func (o *jsonOffsets) record(decoder *json.Decoder, pointer string) {
+	start := int(decoder.InputOffset())
+	for start < len(o.content) && strings.IndexByte(" \t\r\n,:", o.content[start]) >= 0 {
+		start++
+	}
+	o.offsets[pointer] = start
+	token, err := decoder.Token()
+	if err != nil {
+		return
+	}
+	switch token {
+	case json.Delim('{'):
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return
+			}
+			name := strings.ReplaceAll(strings.ReplaceAll(fmt.Sprint(key), "~", "~0"), "/", "~1")
+			o.record(decoder, pointer+"/"+name)
+		}
+		decoder.Token()
+	case json.Delim('['):
+		for i := 0; decoder.More(); i++ {
+			o.record(decoder, pointer+"/"+strconv.Itoa(i))
+		}
+		decoder.Token()
+	}
+}
+
+// errorf returns an error at the value with the given JSON pointer, or at
+// the closest enclosing value that has a position.
+func (o *jsonOffsets) errorf(pointer, format string, args ...interface{}) SchemaError {
+	for {
+		if offset, ok := o.offsets[pointer]; ok {
+			return o.errorAt(offset, format, args...)
+		}
+		i := strings.LastIndex(pointer, "/")
+		if i < 0 {
+			return SchemaError{Message: fmt.Sprintf(format, args...)}
+		}
+		pointer = pointer[:i]
+	}
+}
+
+func (o *jsonOffsets) errorAt(offset int, format string, args ...interface{}) SchemaError {
+	if offset > len(o.content) {
+		offset = len(o.content)
+	}
+	before := o.content[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := offset - bytes.LastIndexByte(before, '\n')
+	return SchemaError{Line: line, Column: column, Message: fmt.Sprintf(format, args...)}
+}
+
+var (
+	avroPrimitives = map[string]bool{
+		"null": true, "boolean": true, "int": true, "long": true,
+		"float": true, "double": true, "bytes": true, "string": true,
+	}
+	avroName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+type avroValidator struct {
+	offsets *jsonOffsets
+	// names are the full names of the named types defined so far.
+	names  map[string]bool
+	errors []SchemaError
+}
+
+func validateAvro(content []byte) []SchemaError {
+	doc, offsets, errs := parseJSON(content)
+	if errs != nil {
+		return errs
+	}
+	v := &avroValidator{offsets: offsets, names: make(map[string]bool)}
+	v.schema(doc, "", "")
+	return v.errors
+}
+
+func (v *avroValidator) errorf(pointer, format string, args ...interface{}) {
+	v.errors = append(v.errors, v.offsets.errorf(pointer, format, args...))
+}
+
+func (v *avroValidator) schema(schema interface{}, pointer, namespace string) {
+	switch schema := schema.(type) {
+	case string:
+		v.reference(schema, pointer, namespace)
+	case []interface{}:
+		if len(schema) == 0 {
+			v.errorf(pointer, "a union must have at least one branch")
+		}
+		for i, branch := range schema {
+			branchPointer := pointer + "/" + strconv.Itoa(i)
+			if _, ok := branch.([]interface{}); ok {
+				v.errorf(branchPointer, "a union may not contain another union")
+				continue
+			}
+			v.schema(branch, branchPointer, namespace)
+		}
+	case map[string]interface{}:
+		v.object(schema, pointer, namespace)
+	default:
+		v.errorf(pointer, "a schema must be a type name, an object or a union")
+	}
+}
+
+func (v *avroValidator) object(schema map[string]interface{}, pointer, namespace string) {
+	typePointer := pointer + "/type"
+	switch t := schema["type"].(type) {
+	case nil:
+		v.errorf(pointer, "missing type")
+	case string:
+		switch t {
+		case "record", "error":
+			namespace = v.define(schema, pointer, namespace)
+			v.fields(schema, pointer, namespace)
+		case "enum":
+			v.define(schema, pointer, namespace)
+			v.symbols(schema, pointer)
+		case "fixed":
+			v.define(schema, pointer, namespace)
+			if size, ok := schema["size"].(json.Number); !ok {
+				v.errorf(pointer, "fixed %v must have a size", schema["name"])
+			} else if n, err := strconv.Atoi(size.String()); err != nil || n < 0 {
+				v.errorf(pointer+"/size", "size must be a non-negative integer, not %v", size)
+			}
+		case "array":
+			if items, ok := schema["items"]; ok {
+				v.schema(items, pointer+"/items", namespace)
+			} else {
+				v.errorf(pointer, "array must have items")
+			}
+		case "map":
+			if values, ok := schema["values"]; ok {
+				v.schema(values, pointer+"/values", namespace)
+			} else {
+				v.errorf(pointer, "map must have values")
+			}
+		default:
+			v.reference(t, typePointer, namespace)
+		}
+	default:
+		v.schema(t, typePointer, namespace)
+	}
+}
+
+// define records the named type schema and returns its namespace, which
+// names within it are relative to.
+func (v *avroValidator) define(schema map[string]interface{}, pointer, namespace string) string {
+	name, ok := schema["name"].(string)
+	if !ok {
+		v.errorf(pointer, "%v must have a name", schema["type"])
+		return namespace
+	}
+	if ns, ok := schema["namespace"].(string); ok {
+		namespace = ns
+	}
+	fullName := name
+	if !strings.Contains(name, ".") && namespace != "" {
+		fullName = namespace + "." + name
+	}
+	for _, part := range strings.Split(fullName, ".") {
+		if !avroName.MatchString(part) {
+			v.errorf(pointer+"/name", "invalid name %q", fullName)
+			break
+		}
+	}
+	if v.names[fullName] {
+		v.errorf(pointer+"/name", "%v is defined more than once", fullName)
+	}
+	v.names[fullName] = true
+	if i := strings.LastIndex(fullName, "."); i >= 0 {
+		return fullName[:i]
+	}
+	return ""
+}
+
+func (v *avroValidator) reference(name, pointer, namespace string) {
+	if avroPrimitives[name] {
+		return
+	}
+	if v.names[name] || (namespace != "" && v.names[namespace+"."+name]) {
+		return
+	}
+	v.errorf(pointer, "unknown type %q", name)
+}
+
+func (v *avroValidator) fields(schema map[string]interface{}, pointer, namespace string) {
+	fields, ok := schema["fields"].([]interface{})
+	if !ok {
+		v.errorf(pointer, "record %v must have a fields array", schema["name"])
+		return
+	}
+	seen := make(map[string]bool)
+	for i, field := range fields {
+		fieldPointer := pointer + "/fields/" + strconv.Itoa(i)
+		f, ok := field.(map[string]interface{})
+		if !ok {
+			v.errorf(fieldPointer, "a field must be an object")
+			continue
+		}
+		name, ok := f["name"].(string)
+		if !ok {
+			v.errorf(fieldPointer, "a field must have a name")
+		} else if !avroName.MatchString(name) {
+			v.errorf(fieldPointer+"/name", "invalid field name %q", name)
+		} else if seen[name] {
+			v.errorf(fieldPointer+"/name", "field %v is defined more than once", name)
+		}
+		seen[name] = true
+		if t, ok := f["type"]; ok {
+			v.schema(t, fieldPointer+"/type", namespace)
+		} else {
+			v.errorf(fieldPointer, "field %v must have a type", name)
+		}
+	}
+}
+
+func (v *avroValidator) symbols(schema map[string]interface{}, pointer string) {
+	symbols, ok := schema["symbols"].([]interface{})
+	if !ok {
+		v.errorf(pointer, "enum %v must have a symbols array", schema["name"])
+		return
+	}
+	seen := make(map[string]bool)
+	for i, symbol := range symbols {
+		symbolPointer := pointer + "/symbols/" + strconv.Itoa(i)
+		s, ok := symbol.(string)
+		if !ok || !avroName.MatchString(s) {
+			v.errorf(symbolPointer, "invalid symbol %v", symbol)
+		} else if seen[s] {
+			v.errorf(symbolPointer, "symbol %v is defined more than once", s)
+		}
+		seen[s] = true
+	}
+}
+
+func validateProtobuf(fileName string, content []byte, importPaths []string) []SchemaError {
+	var errs []SchemaError
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(protocompile.CompositeResolver{
+			&protocompile.SourceResolver{Accessor: protocompile.SourceAccessorFromMap(map[string]string{fileName: string(content)})},
+			&protocompile.SourceResolver{ImportPaths: importPaths},
+		}),
+		Reporter: reporter.NewReporter(func(err reporter.ErrorWithPos) error {
+			pos := err.GetPosition()
+			message := err.Unwrap().Error()
+			if pos.Filename != fileName {
+				message = fmt.Sprintf("in %s:%d:%d: %s", pos.Filename, pos.Line, pos.Col, message)
+				errs = append(errs, SchemaError{Message: message})
+				return nil
+			}
+			errs = append(errs, SchemaError{Line: pos.Line, Column: pos.Col, Message: message})
+			return nil
+		}, nil),
+	}
+	_, err := compiler.Compile(context.Background(), fileName)
+	if err != nil && len(errs) == 0 {
+		errs = append(errs, SchemaError{Message: err.Error()})
+	}
+	return errs
+}
@@ -0,0 +1,125 @@
+package schema_registry_helper
+
+import (
+	"strings"
+	"testing"
+)
+
+var testSchemaValidations = []struct {
+	name       string
+	schemaType SchemaType
+	content    string
+	want       []string // "line:column: message" prefixes, in order
+}{
+	{
+		name:       "valid draft-04",
+		schemaType: Json,
+		content:    `{"$schema": "http://json-schema.org/draft-04/schema#", "properties": {"id": {"$ref": "gorm.types.UUIDValue"}}}`,
+	},
+	{
+		name:       "valid without $schema",
+		schemaType: Json,
+		content:    `{"type": "object", "properties": {"name": {"type": "string"}}}`,
+	},
+	{
+		name:       "syntax error",
+		schemaType: Json,
+		content:    "{\n  \"type\": \"object\",\n  \"properties\": {,}\n}",
+		want:       []string{"3:18: invalid character ','"},
+	},
+	{
+		name:       "truncated",
+		schemaType: Json,
+		content:    "{\n  \"type\": \"object\"",
+		want:       []string{"2:19: unexpected end of JSON input"},
+	},
+	{
+		name:       "trailing content",
+		schemaType: Json,
+		content:    "{}\n}",
+		want:       []string{"2:1: invalid character '}'"},
+	},
+	{
+		name:       "meta-schema errors",
+		schemaType: Json,
+		content:    "{\n  \"$schema\": \"http://json-schema.org/draft-07/schema#\",\n  \"type\": \"objekt\",\n  \"properties\": {\n    \"id\": {\"required\": true}\n  }\n}",
+		want:       []string{`3:11: value must be one of "array"`, "3:11: expected array, but got string", "5:24: expected array, but got boolean"},
+	},
+	{
+		name:       "draft-04 allows boolean required only in draft-03",
+		schemaType: Json,
+		content:    `{"$schema": "http://json-schema.org/draft-04/schema#", "required": true}`,
+		want:       []string{"1:68: "},
+	},
+	{
+		name:       "unknown draft",
+		schemaType: Json,
+		content:    "{\n  \"$schema\": \"http://example.com/my-schema\"\n}",
+		want:       []string{`2:14: unsupported $schema "http://example.com/my-schema"`},
+	},
+	{
+		name:       "valid avro",
+		schemaType: Avro,
+		content: `{"type": "record", "name": "Event", "namespace": "com.infoblox", "fields": [
+			{"name": "id", "type": "string"},
+			{"name": "kind", "type": {"type": "enum", "name": "Kind", "symbols": ["A", "B"]}},
+			{"name": "next", "type": ["null", "Event"]},
+			{"name": "tags", "type": {"type": "map", "values": {"type": "array", "items": "com.infoblox.Kind"}}},
+			{"name": "hash", "type": {"type": "fixed", "name": "Hash", "size": 16}},
+			{"name": "at", "type": {"type": "long", "logicalType": "timestamp-millis"}}
+		]}`,
+	},
+	{
+		name:       "invalid avro",
+		schemaType: Avro,
+		content: `{"type": "record", "name": "Event", "fields": [
+  {"name": "id", "type": "strng"},
+  {"name": "id", "type": "string"},
+  {"name": "kind", "type": {"type": "enum", "name": "Kind", "symbols": ["A", "A", "1"]}},
+  {"name": "data", "type": [["null"]]},
+  {"name": "size", "type": {"type": "fixed", "name": "Size", "size": -1}},
+  {"name": "list", "type": {"type": "array"}}
+]}`,
+		want: []string{
+			`2:26: unknown type "strng"`,
+			"3:12: field id is defined more than once",
+			"4:78: symbol A is defined more than once",
+			"4:83: invalid symbol 1",
+			"5:29: a union may not contain another union",
+			"6:70: size must be a non-negative integer",
+			"7:28: array must have items",
+		},
+	},
+	{
+		name:       "avro syntax error",
+		schemaType: Avro,
+		content:    `{"type": "record",}`,
+		want:       []string{"1:19: invalid character '}'"},
+	},
+	{
+		name:       "valid protobuf",
+		schemaType: Protobuf,
+		content:    "syntax = \"proto3\";\nimport \"google/protobuf/timestamp.proto\";\nmessage Event {\n  google.protobuf.Timestamp at = 1;\n}\n",
+	},
+	{
+		name:       "invalid protobuf",
+		schemaType: Protobuf,
+		content:    "syntax = \"proto3\";\nmessage Event {\n  string id = 1;\n  Unknown kind = 2;\n}\n",
+		want:       []string{`4:3: field Event.kind: unknown type Unknown`},
+	},
+}
+
+func TestValidateSchema(t *testing.T) {
+	for _, tc := range testSchemaValidations {
+		errs := ValidateSchema(tc.schemaType, "event.proto", []byte(tc.content), nil)
+		if len(errs) != len(tc.want) {
+			t.Errorf("%s: got %v, wanted %d errors", tc.name, errs, len(tc.want))
+			continue
+		}
+		for i, err := range errs {
+			if !strings.HasPrefix(err.Error(), tc.want[i]) {
+				t.Errorf("%s: got %q, wanted it to start with %q", tc.name, err.Error(), tc.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package schema_registry_helper
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Records produced by Confluent serializers start with a zero magic byte
+// followed by the big-endian schema ID. Schema ID headers written by newer
+// Confluent clients hold magic byte 1 followed by the 16-byte schema GUID
+// instead.
+const (
+	magicByte        = 0
+	wireHeaderLength = 5
+	guidMagicByte    = 1
+	guidHeaderLength = 17
+)
+
+// Record header names used by Confluent clients to carry the schema ID
+// outside the payload. Their value is either framing.
+const (
+	KeySchemaIDHeader   = "__key_schema_id"
+	ValueSchemaIDHeader = "__value_schema_id"
+)
+
+// ErrUnknownFraming is returned when a record carries its schema ID
+// neither in a header nor as a payload prefix.
+var ErrUnknownFraming = errors.New("record has no schema ID header or payload prefix")
+
+// SchemaIDFraming selects where a Serializer writes the schema ID.
+type SchemaIDFraming int
+
+const (
+	// PrefixFraming writes the magic byte and schema ID before the
+	// payload, as Confluent serializers always have.
+	PrefixFraming SchemaIDFraming = iota
+	// HeaderFraming leaves the payload untouched and writes the schema
+	// ID to the __key_schema_id or __value_schema_id record header, as
+	// the schema GUID when the registry returned one.
+	HeaderFraming
+)
+
+// HeaderCarrier gives access to the headers of a Kafka record, whatever
+// client library produced it. Implement it with a small adapter over the
+// client's header type.
+type HeaderCarrier interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+}
+
+// MapHeaderCarrier is a HeaderCarrier backed by a map.
+type MapHeaderCarrier map[string][]byte
+
+func (m MapHeaderCarrier) Get(key string) ([]byte, bool) {
+	value, ok := m[key]
+	return value, ok
+}
+
+func (m MapHeaderCarrier) Set(key string, value []byte) {
+	m[key] = value
+}
+
+// SerdeConfig configures a Serializer or Deserializer.
+type SerdeConfig struct {
+	// IsKey selects the "-key" subject instead of the "-value" one.
+	IsKey bool
+
+	// Schema is the JSON Schema registered for the Go type. When empty
+	// it is derived from the type with JSONSchemaFor.
+	Schema string
+
+	// AutoRegister registers Schema on first use if the subject does not
+	// already have it. Otherwise the schema must already be registered.
+	AutoRegister bool
+
+	// UseLatest serializes with the latest version of the subject instead
+	// of looking up Schema.
+	UseLatest bool
+
+	// RuleExecutors run the domain rules of the schema, WRITE rules when
+	// serializing and READ rules when deserializing.
+	RuleExecutors RuleExecutors
+
+	// Framing selects where SerializeWithHeaders writes the schema ID.
+	// Deserializers detect the framing of each record themselves.
+	Framing SchemaIDFraming
+}
+
+// Serializer turns values of type T into JSON records framed with the ID
+// of the schema registered for its subject. The schema is resolved on the
+// first call to Serialize and reused afterwards.
+type Serializer[T any] struct {
+	registry SchemaRegistry
+	subject  string
+	config   SerdeConfig
+	lock     sync.Mutex
+	schema   *Schema
+}
+
+// Deserializer turns records written by a Serializer back into values of
+// type T, fetching the writer's schema by the ID in the record.
+type Deserializer[T any] struct {
+	registry SchemaRegistry
+	subject  string
+	config   SerdeConfig
+}
+
+// NewSerializer binds the Go type T to a subject.
+func NewSerializer[T any](registry SchemaRegistry, subject string, config SerdeConfig) *Serializer[T] {
+	return &Serializer[T]{registry: registry, subject: subject, config: config}
+}
+
+// NewDeserializer binds the Go type T to a subject.
+func NewDeserializer[T any](registry SchemaRegistry, subject string, config SerdeConfig) *Deserializer[T] {
+	return &Deserializer[T]{registry: registry, subject: subject, config: config}
+}
+
+// Serialize encodes value as JSON, runs any WRITE domain rules and frames
+// the result with the schema ID prefix, whatever the configured Framing.
+func (s *Serializer[T]) Serialize(value T) ([]byte, error) {
+	schema, payload, err := s.serialize(value)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeSchemaID(schema.ID(), payload), nil
+}
+
+// SerializeWithHeaders behaves like Serialize when Framing is
+// PrefixFraming. With HeaderFraming it returns the bare payload and sets
+// the schema ID header on headers instead.
+func (s *Serializer[T]) SerializeWithHeaders(value T, headers HeaderCarrier) ([]byte, error) {
+	schema, payload, err := s.serialize(value)
+	if err != nil {
+		return nil, err
+	}
+	if s.config.Framing != HeaderFraming {
+		return EncodeSchemaID(schema.ID(), payload), nil
+	}
+	header := EncodeSchemaID(schema.ID(), nil)
+	if schema.GUID() != "" {
+		if header, err = EncodeSchemaGUID(schema.GUID()); err != nil {
+			return nil, err
+		}
+	}
+	headers.Set(schemaIDHeader(s.config.IsKey), header)
+	return payload, nil
+}
+
+func (s *Serializer[T]) serialize(value T) (*Schema, []byte, error) {
+	schema, err := s.Schema()
+	if err != nil {
+		return nil, nil, err
+	}
+	var message interface{} = value
+	if s.config.RuleExecutors != nil {
+		message, err = s.config.RuleExecutors.ExecuteDomainRules(s.subject, schema, RuleModeWrite, message)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return nil, nil, err
+	}
+	return schema, payload, nil
+}
+
+// Schema returns the registered schema used by the serializer, resolving
+// it on first use. A failed lookup is retried on the next call.
+func (s *Serializer[T]) Schema() (*Schema, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.schema != nil {
+		return s.schema, nil
+	}
+	schema, err := s.resolve()
+	if err != nil {
+		return nil, fmt.Errorf("resolving schema for subject %s: %v", s.subject, err)
+	}
+	s.schema = schema
+	return schema, nil
+}
+
+func (s *Serializer[T]) resolve() (*Schema, error) {
+	if s.config.UseLatest {
+		return s.registry.GetLatestSchema(s.subject, s.config.IsKey)
+	}
+
+	text := s.config.Schema
+	if text == "" {
+		var zero T
+		derived, err := JSONSchemaFor(zero)
+		if err != nil {
+			return nil, err
+		}
+		text = derived
+	}
+
+	resp, err := s.registry.CheckSchema(s.subject, text, Json, s.config.IsKey)
+	if err == nil {
+		schema := NewSchemaWithRules(resp.ID, resp.Schema, resp.Version, resp.Metadata, resp.RuleSet)
+		schema.guid = resp.GUID
+		return schema, nil
+	}
+	if !s.config.AutoRegister || !strings.Contains(err.Error(), ErrNotFound) {
+		return nil, err
+	}
+	return s.registry.CreateSchema(s.subject, text, Json, s.config.IsKey)
+}
+
+// Deserialize reads the schema ID from data, decodes the JSON payload
+// into a T and runs any READ domain rules. A TRANSFORM rule must return
+// a T.
+func (d *Deserializer[T]) Deserialize(data []byte) (T, error) {
+	return d.DeserializeWithHeaders(data, nil)
+}
+
+// DeserializeWithHeaders behaves like Deserialize, but first looks for the
+// schema ID or GUID in the record headers. If the header is present the
+// payload is used as is; otherwise the payload must carry the schema ID
+// prefix. headers may be nil.
+func (d *Deserializer[T]) DeserializeWithHeaders(data []byte, headers HeaderCarrier) (T, error) {
+	var value T
+	ref, payload, err := decodeRecord(data, headers, d.config.IsKey)
+	if err != nil {
+		return value, err
+	}
+	if err := json.Unmarshal(payload, &value); err != nil {
+		return value, err
+	}
+	if d.config.RuleExecutors == nil {
+		return value, nil
+	}
+
+	schema, err := d.writerSchema(ref)
+	if err != nil {
+		return value, err
+	}
+	result, err := d.config.RuleExecutors.ExecuteDomainRules(d.subject, schema, RuleModeRead, value)
+	if err != nil {
+		return value, err
+	}
+	transformed, ok := result.(T)
+	if !ok {
+		return value, fmt.Errorf("rules for subject %s returned %T, not %T", d.subject, result, value)
+	}
+	return transformed, nil
+}
+
+// schemaGUIDGetter is implemented by SchemaRegistryClient, but is not part
+// of the SchemaRegistry interface.
+type schemaGUIDGetter interface {
+	GetSchemaByGUID(guid string) (*Schema, error)
+}
+
+func (d *Deserializer[T]) writerSchema(ref schemaRef) (*Schema, error) {
+	if ref.guid == "" {
+		return d.registry.GetSchema(ref.id)
+	}
+	getter, ok := d.registry.(schemaGUIDGetter)
+	if !ok {
+		return nil, fmt.Errorf("the registry cannot look up schema GUID %s", ref.guid)
+	}
+	return getter.GetSchemaByGUID(ref.guid)
+}
+
+func schemaIDHeader(isKey bool) string {
+	if isKey {
+		return KeySchemaIDHeader
+	}
+	return ValueSchemaIDHeader
+}
+
+// schemaRef identifies the writer's schema by ID, or by GUID if set.
+type schemaRef struct {
+	id   int
+	guid string
+}
+
+// decodeRecord finds the schema ID or GUID of a record in either framing.
+func decodeRecord(data []byte, headers HeaderCarrier, isKey bool) (schemaRef, []byte, error) {
+	if headers != nil {
+		if header, ok := headers.Get(schemaIDHeader(isKey)); ok {
+			if guid, err := DecodeSchemaGUID(header); err == nil {
+				return schemaRef{guid: guid}, data, nil
+			}
+			schemaID, rest, err := DecodeSchemaID(header)
+			if err != nil || len(rest) != 0 {
+				return schemaRef{}, nil, fmt.Errorf("invalid %s header", schemaIDHeader(isKey))
+			}
+			return schemaRef{id: schemaID}, data, nil
+		}
+	}
+	schemaID, payload, err := DecodeSchemaID(data)
+	return schemaRef{id: schemaID}, payload, err
+}
+
+// EncodeSchemaID prefixes payload with the magic byte and schema ID.
+func EncodeSchemaID(schemaID int, payload []byte) []byte {
+	data := make([]byte, wireHeaderLength+len(payload))
+	data[0] = magicByte
+	binary.BigEndian.PutUint32(data[1:wireHeaderLength], uint32(schemaID))
+	copy(data[wireHeaderLength:], payload)
+	return data
+}
+
+// DecodeSchemaID splits a record written by EncodeSchemaID into its
+// schema ID and payload.
+func DecodeSchemaID(data []byte) (int, []byte, error) {
+	if len(data) < wireHeaderLength || data[0] != magicByte {
+		return 0, nil, ErrUnknownFraming
+	}
+	return int(binary.BigEndian.Uint32(data[1:wireHeaderLength])), data[wireHeaderLength:], nil
+}
+
+// EncodeSchemaGUID returns the header value newer Confluent clients write
+// for a schema GUID: the magic byte 1 and the 16 bytes of the GUID.
+func EncodeSchemaGUID(guid string) ([]byte, error) {
+	hexDigits := strings.Replace(guid, "-", "", -1)
+	if len(hexDigits) != 32 || strings.Count(guid, "-") != 4 {
+		return nil, fmt.Errorf("invalid schema GUID %q", guid)
+	}
+	data := make([]byte, guidHeaderLength)
+	data[0] = guidMagicByte
+	if _, err := hex.Decode(data[1:], []byte(hexDigits)); err != nil {
+		return nil, fmt.Errorf("invalid schema GUID %q", guid)
+	}
+	return data, nil
+}
+
+// DecodeSchemaGUID reads a header value written by EncodeSchemaGUID and
+// returns the GUID in its usual 8-4-4-4-12 form.
+func DecodeSchemaGUID(data []byte) (string, error) {
+	if len(data) != guidHeaderLength || data[0] != guidMagicByte {
+		return "", ErrUnknownFraming
+	}
+	h := hex.EncodeToString(data[1:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
@@ -0,0 +1,259 @@
+package schema_registry_helper
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testEventMeta struct {
+	Source string `json:"source"`
+}
+
+type testEvent struct {
+	ID       string            `json:"id"`
+	Count    int               `json:"count,omitempty"`
+	Tags     []string          `json:"tags"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Occurred time.Time         `json:"occurred"`
+	Meta     *testEventMeta    `json:"meta"`
+	Parent   *testEvent        `json:"parent,omitempty"`
+	internal string
+}
+
+const testEventSchema = `{
+    "$schema": "http://json-schema.org/draft-07/schema#",
+    "title": "testEvent",
+    "type": "object",
+    "properties": {
+        "count": {
+            "type": "integer"
+        },
+        "id": {
+            "type": "string"
+        },
+        "labels": {
+            "type": "object",
+            "additionalProperties": {
+                "type": "string"
+            }
+        },
+        "meta": {
+            "$ref": "#/definitions/testEventMeta"
+        },
+        "occurred": {
+            "type": "string",
+            "format": "date-time"
+        },
+        "parent": {
+            "$ref": "#/definitions/testEvent"
+        },
+        "tags": {
+            "type": "array",
+            "items": {
+                "type": "string"
+            }
+        }
+    },
+    "required": [
+        "id",
+        "tags",
+        "occurred"
+    ],
+    "definitions": {
+        "testEvent": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "labels": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "meta": {
+                    "$ref": "#/definitions/testEventMeta"
+                },
+                "occurred": {
+                    "type": "string",
+                    "format": "date-time"
+                },
+                "parent": {
+                    "$ref": "#/definitions/testEvent"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            },
+            "required": [
+                "id",
+                "tags",
+                "occurred"
+            ]
+        },
+        "testEventMeta": {
+            "type": "object",
+            "properties": {
+                "source": {
+                    "type": "string"
+                }
+            },
+            "required": [
+                "source"
+            ]
+        }
+    }
+}`
+
+func TestJSONSchemaFor(t *testing.T) {
+	s, err := JSONSchemaFor(testEvent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(s) != testEventSchema {
+		t.Errorf("got:\n%s\nwanted:\n%s", s, testEventSchema)
+	}
+}
+
+func TestSerde(t *testing.T) {
+	registry := NewMemorySchemaRegistry()
+	serializer := NewSerializer[testEvent](registry, "events", SerdeConfig{AutoRegister: true})
+	deserializer := NewDeserializer[testEvent](registry, "events", SerdeConfig{})
+
+	event := testEvent{ID: "a", Tags: []string{"x"}, Occurred: time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)}
+	data, err := serializer.Serialize(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0] != 0 || data[4] != 1 {
+		t.Errorf("got header %v, wanted schema id 1", data[:5])
+	}
+
+	decoded, err := deserializer.Deserialize(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ID != "a" || !decoded.Occurred.Equal(event.Occurred) {
+		t.Errorf("got %+v, wanted %+v", decoded, event)
+	}
+
+	if _, err := deserializer.Deserialize([]byte(`{"id": "a"}`)); err != ErrUnknownFraming {
+		t.Errorf("got error %v, wanted ErrUnknownFraming", err)
+	}
+
+	unregistered := NewSerializer[testEventMeta](registry, "other", SerdeConfig{})
+	if _, err := unregistered.Serialize(testEventMeta{}); err == nil {
+		t.Error("expected an error for an unregistered schema without AutoRegister")
+	}
+}
+
+func TestSerdeHeaderFraming(t *testing.T) {
+	registry := NewMemorySchemaRegistry()
+	prefixed := NewSerializer[testEventMeta](registry, "meta", SerdeConfig{AutoRegister: true})
+	headed := NewSerializer[testEventMeta](registry, "meta", SerdeConfig{AutoRegister: true, Framing: HeaderFraming})
+	deserializer := NewDeserializer[testEventMeta](registry, "meta", SerdeConfig{})
+
+	headers := MapHeaderCarrier{}
+	data, err := headed.SerializeWithHeaders(testEventMeta{Source: "header"}, headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"source":"header"}` {
+		t.Errorf("got payload %q, wanted bare JSON", data)
+	}
+	if _, ok := headers.Get(ValueSchemaIDHeader); !ok {
+		t.Fatalf("missing %s header", ValueSchemaIDHeader)
+	}
+	decoded, err := deserializer.DeserializeWithHeaders(data, headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Source != "header" {
+		t.Errorf("got %+v", decoded)
+	}
+
+	// The same deserializer detects the prefix framing.
+	data, err = prefixed.SerializeWithHeaders(testEventMeta{Source: "prefix"}, MapHeaderCarrier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err = deserializer.DeserializeWithHeaders(data, MapHeaderCarrier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Source != "prefix" {
+		t.Errorf("got %+v", decoded)
+	}
+}
+
+// confluentGUIDHeader is a __value_schema_id header written by a Confluent
+// client for schema GUID 0b6a2f8e-3c1d-4e5f-8a9b-7c6d5e4f3a2b.
+var confluentGUIDHeader = []byte{0x01,
+	0x0b, 0x6a, 0x2f, 0x8e, 0x3c, 0x1d, 0x4e, 0x5f, 0x8a, 0x9b, 0x7c, 0x6d, 0x5e, 0x4f, 0x3a, 0x2b}
+
+func TestSerdeConfluentGUIDHeader(t *testing.T) {
+	const guid = "0b6a2f8e-3c1d-4e5f-8a9b-7c6d5e4f3a2b"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/schemas/guids/" + guid:
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"schema":  `{"type":"object"}`,
+				"ruleSet": RuleSet{DomainRules: []Rule{{Name: "upper", Kind: TransformRule, Mode: RuleModeRead, Type: "TEST"}}},
+			})
+		case "/subjects/meta-value":
+			json.NewEncoder(w).Encode(SchemaResponse{Subject: "meta-value", Version: 1, ID: 3, GUID: guid, Schema: `{"type":"object"}`})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client := CreateSchemaRegistryClient(server.URL)
+
+	guidFromHeader, err := DecodeSchemaGUID(confluentGUIDHeader)
+	if err != nil || guidFromHeader != guid {
+		t.Fatalf("got GUID %q, error %v", guidFromHeader, err)
+	}
+
+	executors := RuleExecutors{"TEST": RuleExecutorFunc(func(ctx RuleContext, message interface{}) (interface{}, error) {
+		meta := message.(testEventMeta)
+		meta.Source = strings.ToUpper(meta.Source)
+		return meta, nil
+	})}
+	deserializer := NewDeserializer[testEventMeta](client, "meta", SerdeConfig{RuleExecutors: executors})
+	headers := MapHeaderCarrier{ValueSchemaIDHeader: confluentGUIDHeader}
+	decoded, err := deserializer.DeserializeWithHeaders([]byte(`{"source":"confluent"}`), headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Source != "CONFLUENT" {
+		t.Errorf("got %+v, wanted the READ rule of the GUID's schema to run", decoded)
+	}
+
+	// Without rules the schema is not needed, whatever the registry.
+	plain := NewDeserializer[testEventMeta](NewMemorySchemaRegistry(), "meta", SerdeConfig{})
+	if decoded, err = plain.DeserializeWithHeaders([]byte(`{"source":"confluent"}`), headers); err != nil || decoded.Source != "confluent" {
+		t.Errorf("got %+v, error %v", decoded, err)
+	}
+
+	// A registry that returns GUIDs gets the same header written.
+	serializer := NewSerializer[testEventMeta](client, "meta", SerdeConfig{Schema: `{"type":"object"}`, Framing: HeaderFraming})
+	headers = MapHeaderCarrier{}
+	if _, err := serializer.SerializeWithHeaders(testEventMeta{Source: "helper"}, headers); err != nil {
+		t.Fatal(err)
+	}
+	if header, _ := headers.Get(ValueSchemaIDHeader); !bytes.Equal(header, confluentGUIDHeader) {
+		t.Errorf("got header %x, wanted %x", header, confluentGUIDHeader)
+	}
+}
@@ -0,0 +1,209 @@
+package schema_registry_helper
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SubjectEventType describes what changed about a watched subject.
+type SubjectEventType string
+
+func (t SubjectEventType) String() string {
+	return string(t)
+}
+
+const (
+	VersionAdded   SubjectEventType = "VERSION_ADDED"
+	VersionDeleted SubjectEventType = "VERSION_DELETED"
+	SubjectDeleted SubjectEventType = "SUBJECT_DELETED"
+)
+
+const (
+	defaultWatchInterval   = 30 * time.Second
+	defaultWatchMaxBackoff = 5 * time.Minute
+)
+
+// SubjectEvent is emitted by a watcher when a subject it polls changes.
+// Version is zero for SubjectDeleted.
+type SubjectEvent struct {
+	Type    SubjectEventType
+	Subject string
+	IsKey   bool
+	Version int
+}
+
+// WatchOptions configures how often a watcher polls the registry.
+// Interval defaults to 30 seconds. After a failed poll the watcher waits
+// twice as long as the previous attempt, up to MaxBackoff (default five
+// minutes), and returns to Interval once a poll succeeds. OnError, if
+// set, is called with every failed poll.
+type WatchOptions struct {
+	Interval   time.Duration
+	MaxBackoff time.Duration
+	OnError    func(subject string, err error)
+}
+
+// WatchSubjects polls the versions of the given subjects and delivers
+// every change on the returned channel, until ctx is cancelled, at which
+// point the channel is closed. The first poll only records the versions
+// that already exist; it does not produce events.
+func (client *SchemaRegistryClient) WatchSubjects(ctx context.Context, subjects []string, isKey bool, options WatchOptions) <-chan SubjectEvent {
+	events := make(chan SubjectEvent)
+	go func() {
+		defer close(events)
+		client.WatchSubjectsFunc(ctx, subjects, isKey, options, func(event SubjectEvent) {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	return events
+}
+
+// WatchSubjectsFunc behaves like WatchSubjects, but calls onEvent for
+// every change and blocks until ctx is cancelled. Cache entries affected
+// by a change are invalidated before onEvent is called, so the callback
+// can immediately fetch the new schema.
+func (client *SchemaRegistryClient) WatchSubjectsFunc(ctx context.Context, subjects []string, isKey bool,
+	options WatchOptions, onEvent func(SubjectEvent)) {
+
+	if options.Interval <= 0 {
+		options.Interval = defaultWatchInterval
+	}
+	if options.MaxBackoff < options.Interval {
+		options.MaxBackoff = defaultWatchMaxBackoff
+		if options.MaxBackoff < options.Interval {
+			options.MaxBackoff = options.Interval
+		}
+	}
+
+	known := make(map[string][]int)
+	initialized := make(map[string]bool)
+	wait := time.Duration(0)
+	for {
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		} else if ctx.Err() != nil {
+			return
+		}
+
+		failed := false
+		for _, subject := range subjects {
+			versions, err := client.GetSchemaVersions(subject, isKey)
+			if err != nil && strings.Contains(err.Error(), ErrNotFound) {
+				versions, err = []int{}, nil
+			}
+			if err != nil {
+				failed = true
+				if options.OnError != nil {
+					options.OnError(subject, err)
+				}
+				continue
+			}
+			sort.Ints(versions)
+			if initialized[subject] {
+				for _, event := range diffVersions(subject, isKey, known[subject], versions) {
+					client.invalidateSubjectEvent(event)
+					onEvent(event)
+				}
+			}
+			known[subject] = versions
+			initialized[subject] = true
+		}
+
+		switch {
+		case !failed:
+			wait = options.Interval
+		case wait < options.Interval:
+			wait = options.Interval
+		default:
+			wait *= 2
+			if wait > options.MaxBackoff {
+				wait = options.MaxBackoff
+			}
+		}
+	}
+}
+
+// diffVersions compares two sorted version lists. A subject whose last
+// version disappears is reported as deleted rather than once per version.
+func diffVersions(subject string, isKey bool, previous, current []int) []SubjectEvent {
+	events := make([]SubjectEvent, 0)
+	if len(previous) > 0 && len(current) == 0 {
+		return append(events, SubjectEvent{Type: SubjectDeleted, Subject: subject, IsKey: isKey})
+	}
+
+	seen := make(map[int]bool, len(current))
+	for _, v := range current {
+		seen[v] = true
+	}
+	for _, v := range previous {
+		if !seen[v] {
+			events = append(events, SubjectEvent{Type: VersionDeleted, Subject: subject, IsKey: isKey, Version: v})
+		}
+		delete(seen, v)
+	}
+	for _, v := range current {
+		if seen[v] {
+			events = append(events, SubjectEvent{Type: VersionAdded, Subject: subject, IsKey: isKey, Version: v})
+		}
+	}
+	return events
+}
+
+// invalidateSubjectEvent drops the cache entries made stale by an event.
+// Entries in the id-2-schema cache are kept, because a schema ID always
+// refers to the same schema.
+func (client *SchemaRegistryClient) invalidateSubjectEvent(event SubjectEvent) {
+	concreteSubject := client.getConcreteSubject(event.Subject, event.IsKey)
+
+	stale := []string{cacheKey(concreteSubject, "latest")}
+	client.subjectSchemaCacheLock.Lock()
+	switch event.Type {
+	case VersionDeleted:
+		stale = append(stale, cacheKey(concreteSubject, strconv.Itoa(event.Version)))
+	case SubjectDeleted:
+		prefix := cacheKey(concreteSubject, "")
+		for key := range client.subjectSchemaCache {
+			if strings.HasPrefix(key, prefix) {
+				if _, err := strconv.Atoi(strings.TrimPrefix(key, prefix)); err == nil {
+					stale = append(stale, key)
+				}
+			}
+		}
+	}
+	evicted := 0
+	for _, key := range stale {
+		if _, ok := client.subjectSchemaCache[key]; ok {
+			delete(client.subjectSchemaCache, key)
+			evicted++
+		}
+	}
+	client.subjectSchemaCacheLock.Unlock()
+	if evicted > 0 {
+		client.instrumentation.CacheEvicted(SubjectSchemaCache, evicted)
+	}
+
+	// Any version change alters which subjects use a schema ID, and
+	// the IDs involved are not known without another request.
+	client.idUsageCacheLock.Lock()
+	if n := len(client.idSubjectsCache); n > 0 {
+		client.idSubjectsCache = make(map[int]usageEntry[string])
+		client.instrumentation.CacheEvicted(IDSubjectsCache, n)
+	}
+	if n := len(client.idVersionsCache); n > 0 {
+		client.idVersionsCache = make(map[int]usageEntry[SubjectVersion])
+		client.instrumentation.CacheEvicted(IDVersionsCache, n)
+	}
+	client.idUsageCacheLock.Unlock()
+}
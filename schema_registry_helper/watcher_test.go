@@ -0,0 +1,70 @@
+package schema_registry_helper
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatchSubjects(t *testing.T) {
+	var lock sync.Mutex
+	versions := []int{1}
+	polls := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		defer func() {
+			select {
+			case polls <- struct{}{}:
+			default:
+			}
+		}()
+		if len(versions) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error_code": 40401, "message": "Subject not found"})
+			return
+		}
+		json.NewEncoder(w).Encode(versions)
+	}))
+	defer server.Close()
+
+	client := CreateSchemaRegistryClient(server.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	events := client.WatchSubjects(ctx, []string{"topic"}, false, WatchOptions{Interval: 5 * time.Millisecond})
+
+	<-polls
+	lock.Lock()
+	versions = []int{1, 2}
+	lock.Unlock()
+	expectEvent(t, events, SubjectEvent{Type: VersionAdded, Subject: "topic", Version: 2})
+
+	lock.Lock()
+	versions = []int{2}
+	lock.Unlock()
+	expectEvent(t, events, SubjectEvent{Type: VersionDeleted, Subject: "topic", Version: 1})
+
+	lock.Lock()
+	versions = nil
+	lock.Unlock()
+	expectEvent(t, events, SubjectEvent{Type: SubjectDeleted, Subject: "topic"})
+
+	cancel()
+	for range events {
+	}
+}
+
+func expectEvent(t *testing.T, events <-chan SubjectEvent, expected SubjectEvent) {
+	t.Helper()
+	select {
+	case event := <-events:
+		if event != expected {
+			t.Errorf("got event %+v, wanted %+v", event, expected)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %+v", expected)
+	}
+}
@@ -0,0 +1,800 @@
+// Package schema_registry_server is a small, file-backed implementation of
+// the Confluent Schema Registry REST API, meant for local development and
+// tests. It covers the subset used by SchemaRegistryClient: subjects,
+// versions, schema IDs, lookup, config, mode and compatibility.
+//
+// Schema IDs and versions are assigned the way the registry assigns them:
+// IDs are global and reused for identical schemas, and versions are
+// numbered per subject and never reused. Compatibility rules are enforced
+// for PROTOBUF schemas using CheckProtobufCompatibility, as leniently as
+// the registry does; JSON and AVRO schemas are only checked to be valid
+// JSON. All contexts share one ID space.
+package schema_registry_server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/infobloxopen/schema-registry-helper/schema_registry_helper"
+)
+
+const (
+	contentType          = "application/vnd.schemaregistry.v1+json"
+	defaultCompatibility = "BACKWARD"
+	defaultMode          = "READWRITE"
+)
+
+var compatibilityLevels = map[string]bool{
+	"NONE":                true,
+	"BACKWARD":            true,
+	"BACKWARD_TRANSITIVE": true,
+	"FORWARD":             true,
+	"FORWARD_TRANSITIVE":  true,
+	"FULL":                true,
+	"FULL_TRANSITIVE":     true,
+}
+
+var modes = map[string]bool{
+	"READWRITE": true,
+	"READONLY":  true,
+	"IMPORT":    true,
+}
+
+// Error codes returned by the registry, alongside an HTTP status that is
+// the first three digits of the code.
+const (
+	errSubjectNotFound       = 40401
+	errVersionNotFound       = 40402
+	errSchemaNotFound        = 40403
+	errSubjectSoftDeleted    = 40404
+	errSubjectNotSoftDeleted = 40405
+	errSubjectConfigNotFound = 40408
+	errSubjectModeNotFound   = 40409
+	errIncompatibleSchema    = 409
+	errInvalidSchema         = 42201
+	errInvalidVersion        = 42202
+	errInvalidCompatibility  = 42203
+	errInvalidMode           = 42204
+	errOperationNotPermitted = 42205
+	errReferenceExists       = 42206
+	errStore                 = 50001
+)
+
+// Server serves the registry API from the state stored in a directory.
+type Server struct {
+	dir   string
+	lock  sync.Mutex
+	state *state
+}
+
+// rawSchema is written as is, since only JSON and AVRO schemas are JSON.
+type rawSchema string
+
+type registryError struct {
+	code    int
+	message string
+}
+
+func (e *registryError) Error() string {
+	return e.message
+}
+
+func newError(code int, format string, args ...interface{}) *registryError {
+	return &registryError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+type schemaRequest struct {
+	Schema     string                             `json:"schema"`
+	SchemaType string                             `json:"schemaType,omitempty"`
+	References []schema_registry_helper.Reference `json:"references,omitempty"`
+	Metadata   *schema_registry_helper.Metadata   `json:"metadata,omitempty"`
+	RuleSet    *schema_registry_helper.RuleSet    `json:"ruleSet,omitempty"`
+	ID         int                                `json:"id,omitempty"`
+	Version    int                                `json:"version,omitempty"`
+}
+
+type schemaResponse struct {
+	Subject    string                             `json:"subject,omitempty"`
+	Version    int                                `json:"version,omitempty"`
+	ID         int                                `json:"id,omitempty"`
+	Schema     string                             `json:"schema"`
+	SchemaType string                             `json:"schemaType,omitempty"`
+	References []schema_registry_helper.Reference `json:"references,omitempty"`
+	Metadata   *schema_registry_helper.Metadata   `json:"metadata,omitempty"`
+	RuleSet    *schema_registry_helper.RuleSet    `json:"ruleSet,omitempty"`
+}
+
+// NewServer creates a server that keeps its state in dir, loading any
+// state saved there by an earlier run.
+func NewServer(dir string) (*Server, error) {
+	st, err := loadState(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{dir: dir, state: st}, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments, err := splitPath(r.URL.EscapedPath())
+	if err != nil {
+		writeError(w, newError(404, "Invalid path"))
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	result, err := s.route(r, segments)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	if raw, ok := result.(rawSchema); ok {
+		w.Write([]byte(raw))
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+func splitPath(path string) ([]string, error) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) == 1 && segments[0] == "" {
+		return nil, nil
+	}
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, err
+		}
+		segments[i] = unescaped
+	}
+	return segments, nil
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	re, ok := err.(*registryError)
+	if !ok {
+		re = newError(errStore, "%v", err)
+	}
+	status := re.code
+	for status >= 1000 {
+		status /= 10
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error_code": re.code, "message": re.message})
+}
+
+func methodNotAllowed() error {
+	return newError(405, "HTTP method not allowed")
+}
+
+func (s *Server) route(r *http.Request, p []string) (interface{}, error) {
+	query := r.URL.Query()
+	deleted := query.Get("deleted") == "true"
+	switch {
+	case len(p) == 0:
+		return map[string]interface{}{}, nil
+
+	case len(p) == 1 && p[0] == "contexts" && r.Method == "GET":
+		return s.contexts(), nil
+
+	case len(p) == 2 && p[0] == "schemas" && p[1] == "types" && r.Method == "GET":
+		return []string{"AVRO", "JSON", "PROTOBUF"}, nil
+
+	case len(p) >= 3 && len(p) <= 4 && p[0] == "schemas" && p[1] == "ids" && r.Method == "GET":
+		id, err := strconv.Atoi(p[2])
+		if err != nil {
+			return nil, newError(errSchemaNotFound, "Schema %s not found", p[2])
+		}
+		if len(p) == 3 {
+			return s.schemaByID(id)
+		}
+		switch p[3] {
+		case "subjects":
+			return s.subjectsByID(id, deleted)
+		case "versions":
+			return s.versionsByID(id, deleted)
+		}
+
+	case len(p) == 1 && p[0] == "subjects" && r.Method == "GET":
+		return s.subjects(query.Get("subjectPrefix"), deleted), nil
+
+	case len(p) == 2 && p[0] == "subjects":
+		switch r.Method {
+		case "POST":
+			req, err := decodeSchemaRequest(r)
+			if err != nil {
+				return nil, err
+			}
+			return s.lookup(p[1], req, deleted)
+		case "DELETE":
+			return s.deleteSubject(p[1], query.Get("permanent") == "true")
+		}
+		return nil, methodNotAllowed()
+
+	case len(p) == 3 && p[0] == "subjects" && p[2] == "versions":
+		switch r.Method {
+		case "GET":
+			return s.versions(p[1], deleted)
+		case "POST":
+			req, err := decodeSchemaRequest(r)
+			if err != nil {
+				return nil, err
+			}
+			return s.register(p[1], req)
+		}
+		return nil, methodNotAllowed()
+
+	case len(p) == 3 && p[0] == "subjects" && p[2] == "metadata" && r.Method == "GET":
+		return s.latestWithMetadata(p[1], query["key"], query["value"])
+
+	case len(p) >= 4 && len(p) <= 5 && p[0] == "subjects" && p[2] == "versions":
+		// A permanent delete applies to a version that was soft-deleted.
+		permanent := r.Method == "DELETE" && query.Get("permanent") == "true"
+		v, err := s.resolveVersion(p[1], p[3], deleted || permanent)
+		if err != nil {
+			return nil, err
+		}
+		if len(p) == 5 && p[4] == "referencedby" && r.Method == "GET" {
+			return s.state.referencedBy(p[1], v.Version), nil
+		}
+		if len(p) == 5 && p[4] == "schema" && r.Method == "GET" {
+			return rawSchema(s.state.Schemas[v.ID].Schema), nil
+		}
+		if len(p) == 4 && r.Method == "GET" {
+			return s.versionResponse(p[1], v), nil
+		}
+		if len(p) == 4 && r.Method == "DELETE" {
+			return s.deleteVersion(p[1], v, permanent)
+		}
+		return nil, methodNotAllowed()
+
+	case (len(p) == 1 || len(p) == 2) && (p[0] == "config" || p[0] == "mode"):
+		subject := ""
+		if len(p) == 2 {
+			subject = p[1]
+		}
+		if p[0] == "config" {
+			return s.config(r, subject, query.Get("defaultToGlobal") == "true")
+		}
+		return s.mode(r, subject, query.Get("defaultToGlobal") == "true")
+
+	case len(p) >= 4 && len(p) <= 5 && p[0] == "compatibility" && p[1] == "subjects" && p[3] == "versions" && r.Method == "POST":
+		req, err := decodeSchemaRequest(r)
+		if err != nil {
+			return nil, err
+		}
+		version := ""
+		if len(p) == 5 {
+			version = p[4]
+		}
+		return s.testCompatibility(p[2], version, req, query.Get("verbose") == "true")
+	}
+	return nil, newError(404, "HTTP 404 Not Found")
+}
+
+func decodeSchemaRequest(r *http.Request) (*schemaRequest, error) {
+	req := new(schemaRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return nil, newError(errInvalidSchema, "Invalid request body: %v", err)
+	}
+	if req.SchemaType == "" {
+		req.SchemaType = schema_registry_helper.Avro.String()
+	}
+	return req, nil
+}
+
+func (s *Server) contexts() []string {
+	seen := map[string]bool{schema_registry_helper.DefaultContext: true}
+	for name := range s.state.Subjects {
+		c, _ := schema_registry_helper.SplitQualifiedSubject(name)
+		seen[c] = true
+	}
+	contexts := make([]string, 0, len(seen))
+	for c := range seen {
+		contexts = append(contexts, c)
+	}
+	sort.Strings(contexts)
+	return contexts
+}
+
+// subjects lists the subjects starting with prefix. Without a prefix only
+// subjects in the default context are listed.
+func (s *Server) subjects(prefix string, deleted bool) []string {
+	names := make([]string, 0)
+	for _, name := range s.state.subjectNames(deleted) {
+		c, _ := schema_registry_helper.SplitQualifiedSubject(name)
+		if prefix == "" && c != schema_registry_helper.DefaultContext {
+			continue
+		}
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (s *Server) schemaByID(id int) (interface{}, error) {
+	schema, ok := s.state.Schemas[id]
+	if !ok {
+		return nil, newError(errSchemaNotFound, "Schema %d not found", id)
+	}
+	resp := schemaResponseFor(schema)
+	return resp, nil
+}
+
+func (s *Server) subjectsByID(id int, deleted bool) (interface{}, error) {
+	versions, err := s.versionsByID(id, deleted)
+	if err != nil {
+		return nil, err
+	}
+	subjects := make([]string, 0)
+	for _, v := range versions {
+		if len(subjects) == 0 || subjects[len(subjects)-1] != v.Subject {
+			subjects = append(subjects, v.Subject)
+		}
+	}
+	return subjects, nil
+}
+
+func (s *Server) versionsByID(id int, deleted bool) ([]schema_registry_helper.SubjectVersion, error) {
+	if _, ok := s.state.Schemas[id]; !ok {
+		return nil, newError(errSchemaNotFound, "Schema %d not found", id)
+	}
+	versions := make([]schema_registry_helper.SubjectVersion, 0)
+	for _, name := range s.state.subjectNames(true) {
+		for _, v := range s.state.Subjects[name].Versions {
+			if v.ID == id && (deleted || !v.Deleted) {
+				versions = append(versions, schema_registry_helper.SubjectVersion{Subject: name, Version: v.Version})
+			}
+		}
+	}
+	return versions, nil
+}
+
+func (s *Server) versions(subject string, deleted bool) (interface{}, error) {
+	sub, ok := s.state.Subjects[subject]
+	if !ok || (!deleted && len(s.state.liveVersions(subject)) == 0) {
+		return nil, newError(errSubjectNotFound, "Subject '%s' not found.", subject)
+	}
+	versions := make([]int, 0, len(sub.Versions))
+	for _, v := range sub.Versions {
+		if deleted || !v.Deleted {
+			versions = append(versions, v.Version)
+		}
+	}
+	return versions, nil
+}
+
+// resolveVersion accepts a version number, "latest" or -1.
+func (s *Server) resolveVersion(subject, version string, deleted bool) (*storedVersion, error) {
+	if _, ok := s.state.Subjects[subject]; !ok {
+		return nil, newError(errSubjectNotFound, "Subject '%s' not found.", subject)
+	}
+	if version == "latest" || version == "-1" {
+		live := s.state.liveVersions(subject)
+		if len(live) == 0 {
+			return nil, newError(errSubjectNotFound, "Subject '%s' not found.", subject)
+		}
+		return live[len(live)-1], nil
+	}
+	n, err := strconv.Atoi(version)
+	if err != nil || n <= 0 {
+		return nil, newError(errInvalidVersion, "The specified version '%s' is not a valid version id. "+
+			"Allowed values are between [1, 2^31-1] and the string \"latest\"", version)
+	}
+	v := s.state.findVersion(subject, n)
+	if v == nil || (v.Deleted && !deleted) {
+		return nil, newError(errVersionNotFound, "Version %d not found.", n)
+	}
+	return v, nil
+}
+
+func (s *Server) versionResponse(subject string, v *storedVersion) *schemaResponse {
+	resp := schemaResponseFor(s.state.Schemas[v.ID])
+	resp.Subject = subject
+	resp.Version = v.Version
+	resp.ID = v.ID
+	return resp
+}
+
+// The registry leaves schemaType out of responses for AVRO schemas.
+func schemaResponseFor(schema *storedSchema) *schemaResponse {
+	resp := &schemaResponse{
+		Schema:     schema.Schema,
+		SchemaType: schema.SchemaType,
+		References: schema.References,
+		Metadata:   schema.Metadata,
+		RuleSet:    schema.RuleSet,
+	}
+	if resp.SchemaType == schema_registry_helper.Avro.String() {
+		resp.SchemaType = ""
+	}
+	return resp
+}
+
+func (s *Server) lookup(subject string, req *schemaRequest, deleted bool) (interface{}, error) {
+	sub, ok := s.state.Subjects[subject]
+	if !ok || (!deleted && len(s.state.liveVersions(subject)) == 0) {
+		return nil, newError(errSubjectNotFound, "Subject '%s' not found.", subject)
+	}
+	candidate := storedFromRequest(req)
+	for _, v := range sub.Versions {
+		if (deleted || !v.Deleted) && s.state.Schemas[v.ID].equal(candidate) {
+			return s.versionResponse(subject, v), nil
+		}
+	}
+	return nil, newError(errSchemaNotFound, "Schema not found")
+}
+
+func storedFromRequest(req *schemaRequest) *storedSchema {
+	return &storedSchema{
+		Schema:     req.Schema,
+		SchemaType: req.SchemaType,
+		References: nilIfEmpty(req.References),
+		Metadata:   req.Metadata,
+		RuleSet:    req.RuleSet,
+	}
+}
+
+func (s *Server) register(subject string, req *schemaRequest) (interface{}, error) {
+	mode := s.state.mode(subject)
+	if mode == "READONLY" {
+		return nil, newError(errOperationNotPermitted, "Subject %s is in read-only mode", subject)
+	}
+	if (req.ID > 0 || req.Version > 0) && mode != "IMPORT" {
+		return nil, newError(errOperationNotPermitted, "Subject %s is not in import mode", subject)
+	}
+	if err := s.validate(req); err != nil {
+		return nil, err
+	}
+
+	candidate := storedFromRequest(req)
+	for _, v := range s.state.liveVersions(subject) {
+		if s.state.Schemas[v.ID].equal(candidate) {
+			return map[string]int{"id": v.ID}, nil
+		}
+	}
+
+	if mode != "IMPORT" {
+		if messages := s.checkCompatibility(subject, candidate, s.state.compatibility(subject), nil); len(messages) > 0 {
+			return nil, newError(errIncompatibleSchema, "Schema being registered is incompatible with an earlier schema "+
+				"for subject \"%s\", details: %s", subject, strings.Join(messages, "; "))
+		}
+	}
+
+	sub, ok := s.state.Subjects[subject]
+	if !ok {
+		sub = &storedSubject{}
+	}
+	version := 1
+	if len(sub.Versions) > 0 {
+		version = sub.Versions[len(sub.Versions)-1].Version + 1
+	}
+
+	id := 0
+	if req.ID > 0 {
+		if existing, ok := s.state.Schemas[req.ID]; ok && !existing.equal(candidate) {
+			return nil, newError(errInvalidSchema, "Overwrite new schema with id %d is not permitted.", req.ID)
+		}
+		id = req.ID
+		s.state.Schemas[id] = candidate
+		if id >= s.state.NextID {
+			s.state.NextID = id + 1
+		}
+		if req.Version > 0 {
+			version = req.Version
+		}
+	} else {
+		id = s.state.idFor(candidate)
+	}
+
+	sub.Versions = append(sub.Versions, &storedVersion{Version: version, ID: id})
+	sort.Slice(sub.Versions, func(i, j int) bool { return sub.Versions[i].Version < sub.Versions[j].Version })
+	s.state.Subjects[subject] = sub
+	if err := s.state.save(s.dir); err != nil {
+		return nil, err
+	}
+	return map[string]int{"id": id}, nil
+}
+
+// validate parses the schema and checks that its references exist.
+func (s *Server) validate(req *schemaRequest) error {
+	for _, r := range req.References {
+		v := s.state.findVersion(r.Subject, r.Version)
+		if v == nil || v.Deleted {
+			return newError(errInvalidSchema, "Invalid schema: reference %s to subject %s version %d not found",
+				r.Name, r.Subject, r.Version)
+		}
+	}
+	switch schema_registry_helper.SchemaType(req.SchemaType) {
+	case schema_registry_helper.Protobuf:
+		_, err := schema_registry_helper.CheckProtobufCompatibility(s.protobufSchema(storedFromRequest(req)),
+			s.protobufSchema(storedFromRequest(req)), true)
+		if err != nil {
+			return newError(errInvalidSchema, "Invalid schema: %v", err)
+		}
+	case schema_registry_helper.Json, schema_registry_helper.Avro:
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(req.Schema), &parsed); err != nil {
+			return newError(errInvalidSchema, "Invalid schema: %v", err)
+		}
+	default:
+		return newError(errInvalidSchema, "Invalid schema type %s", req.SchemaType)
+	}
+	return nil
+}
+
+// protobufSchema resolves the references of a stored schema, and theirs,
+// into the imports needed to compile it.
+func (s *Server) protobufSchema(schema *storedSchema) schema_registry_helper.ProtobufSchema {
+	imports := make(map[string]string)
+	var resolve func(references []schema_registry_helper.Reference)
+	resolve = func(references []schema_registry_helper.Reference) {
+		for _, r := range references {
+			if _, ok := imports[r.Name]; ok {
+				continue
+			}
+			v := s.state.findVersion(r.Subject, r.Version)
+			if v == nil {
+				continue
+			}
+			referenced := s.state.Schemas[v.ID]
+			imports[r.Name] = referenced.Schema
+			resolve(referenced.References)
+		}
+	}
+	resolve(schema.References)
+	return schema_registry_helper.ProtobufSchema{Schema: schema.Schema, Imports: imports}
+}
+
+// checkCompatibility returns a message for every incompatibility between
+// candidate and the versions of subject selected by level. A nil against
+// selects the versions from the level; otherwise only against is used.
+func (s *Server) checkCompatibility(subject string, candidate *storedSchema, level string, against []*storedVersion) []string {
+	if level == "NONE" {
+		return nil
+	}
+	if against == nil {
+		against = s.state.liveVersions(subject)
+		if !strings.HasSuffix(level, "_TRANSITIVE") && len(against) > 0 {
+			against = against[len(against)-1:]
+		}
+	}
+	base := strings.TrimSuffix(level, "_TRANSITIVE")
+
+	messages := make([]string, 0)
+	for _, v := range against {
+		existing := s.state.Schemas[v.ID]
+		if existing.SchemaType != candidate.SchemaType {
+			messages = append(messages, fmt.Sprintf("version %d has schema type %s, not %s",
+				v.Version, existing.SchemaType, candidate.SchemaType))
+			continue
+		}
+		if candidate.SchemaType != schema_registry_helper.Protobuf.String() {
+			continue
+		}
+		pairs := make([][2]*storedSchema, 0, 2)
+		if base == "BACKWARD" || base == "FULL" {
+			pairs = append(pairs, [2]*storedSchema{existing, candidate})
+		}
+		if base == "FORWARD" || base == "FULL" {
+			pairs = append(pairs, [2]*storedSchema{candidate, existing})
+		}
+		for _, pair := range pairs {
+			diffs, err := schema_registry_helper.CheckProtobufCompatibility(s.protobufSchema(pair[0]), s.protobufSchema(pair[1]), true)
+			if err != nil {
+				messages = append(messages, err.Error())
+				continue
+			}
+			for _, d := range diffs {
+				if d.Incompatible {
+					messages = append(messages, fmt.Sprintf("version %d: %s", v.Version, d))
+				}
+			}
+		}
+	}
+	return messages
+}
+
+func (s *Server) testCompatibility(subject, version string, req *schemaRequest, verbose bool) (interface{}, error) {
+	if err := s.validate(req); err != nil {
+		return nil, err
+	}
+	var against []*storedVersion
+	level := s.state.compatibility(subject)
+	if version != "" {
+		v, err := s.resolveVersion(subject, version, false)
+		if err != nil {
+			return nil, err
+		}
+		against = []*storedVersion{v}
+		level = strings.TrimSuffix(level, "_TRANSITIVE")
+	}
+	messages := s.checkCompatibility(subject, storedFromRequest(req), level, against)
+	result := map[string]interface{}{"is_compatible": len(messages) == 0}
+	if verbose {
+		result["messages"] = messages
+	}
+	return result, nil
+}
+
+func (s *Server) latestWithMetadata(subject string, keys, values []string) (interface{}, error) {
+	live := s.state.liveVersions(subject)
+	if len(live) == 0 {
+		return nil, newError(errSubjectNotFound, "Subject '%s' not found.", subject)
+	}
+	for i := len(live) - 1; i >= 0; i-- {
+		metadata := s.state.Schemas[live[i].ID].Metadata
+		matches := true
+		for j, key := range keys {
+			if j >= len(values) || metadata == nil || metadata.Properties[key] != values[j] {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return s.versionResponse(subject, live[i]), nil
+		}
+	}
+	return nil, newError(errSchemaNotFound, "Schema not found")
+}
+
+func (s *Server) deleteSubject(subject string, permanent bool) (interface{}, error) {
+	sub, ok := s.state.Subjects[subject]
+	if !ok {
+		return nil, newError(errSubjectNotFound, "Subject '%s' not found.", subject)
+	}
+	if s.state.mode(subject) == "READONLY" {
+		return nil, newError(errOperationNotPermitted, "Subject %s is in read-only mode", subject)
+	}
+	live := s.state.liveVersions(subject)
+	if permanent && len(live) > 0 {
+		return nil, newError(errSubjectNotSoftDeleted, "Subject '%s' was not deleted first before being permanently deleted", subject)
+	}
+	if !permanent && len(live) == 0 {
+		return nil, newError(errSubjectSoftDeleted, "Subject '%s' was soft deleted.Set permanent=true to delete permanently", subject)
+	}
+	for _, v := range sub.Versions {
+		if refs := s.state.referencedBy(subject, v.Version); len(refs) > 0 {
+			return nil, newError(errReferenceExists, "One or more references exist to the schema {subject=%s,version=%d}", subject, v.Version)
+		}
+	}
+
+	versions := make([]int, 0, len(sub.Versions))
+	for _, v := range sub.Versions {
+		versions = append(versions, v.Version)
+		v.Deleted = true
+	}
+	if permanent {
+		delete(s.state.Subjects, subject)
+		delete(s.state.Config, subject)
+		delete(s.state.Mode, subject)
+	}
+	if err := s.state.save(s.dir); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+func (s *Server) deleteVersion(subject string, v *storedVersion, permanent bool) (interface{}, error) {
+	if s.state.mode(subject) == "READONLY" {
+		return nil, newError(errOperationNotPermitted, "Subject %s is in read-only mode", subject)
+	}
+	if permanent && !v.Deleted {
+		return nil, newError(errSubjectNotSoftDeleted, "Subject '%s' Version %d was not deleted first before being permanently deleted", subject, v.Version)
+	}
+	if refs := s.state.referencedBy(subject, v.Version); len(refs) > 0 {
+		return nil, newError(errReferenceExists, "One or more references exist to the schema {subject=%s,version=%d}", subject, v.Version)
+	}
+
+	v.Deleted = true
+	if permanent {
+		sub := s.state.Subjects[subject]
+		for i, existing := range sub.Versions {
+			if existing == v {
+				sub.Versions = append(sub.Versions[:i], sub.Versions[i+1:]...)
+				break
+			}
+		}
+		if len(sub.Versions) == 0 {
+			delete(s.state.Subjects, subject)
+		}
+	}
+	if err := s.state.save(s.dir); err != nil {
+		return nil, err
+	}
+	return v.Version, nil
+}
+
+func (s *Server) config(r *http.Request, subject string, defaultToGlobal bool) (interface{}, error) {
+	switch r.Method {
+	case "GET":
+		level, ok := s.state.Config[subject]
+		if !ok && !defaultToGlobal {
+			return nil, newError(errSubjectConfigNotFound, "Subject '%s' does not have subject-level compatibility configured", subject)
+		}
+		if !ok {
+			level = s.state.Config[""]
+		}
+		return map[string]string{"compatibilityLevel": level}, nil
+	case "PUT":
+		var req struct {
+			Compatibility string `json:"compatibility"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !compatibilityLevels[req.Compatibility] {
+			return nil, newError(errInvalidCompatibility, "Invalid compatibility level. Valid values are none, backward, "+
+				"forward, full, backward_transitive, forward_transitive, and full_transitive")
+		}
+		s.state.Config[subject] = req.Compatibility
+		if err := s.state.save(s.dir); err != nil {
+			return nil, err
+		}
+		return map[string]string{"compatibility": req.Compatibility}, nil
+	case "DELETE":
+		level, ok := s.state.Config[subject]
+		if !ok {
+			return nil, newError(errSubjectConfigNotFound, "Subject '%s' does not have subject-level compatibility configured", subject)
+		}
+		if subject == "" {
+			s.state.Config[""] = defaultCompatibility
+		} else {
+			delete(s.state.Config, subject)
+		}
+		if err := s.state.save(s.dir); err != nil {
+			return nil, err
+		}
+		return map[string]string{"compatibilityLevel": level}, nil
+	}
+	return nil, methodNotAllowed()
+}
+
+func (s *Server) mode(r *http.Request, subject string, defaultToGlobal bool) (interface{}, error) {
+	switch r.Method {
+	case "GET":
+		mode, ok := s.state.Mode[subject]
+		if !ok && !defaultToGlobal {
+			return nil, newError(errSubjectModeNotFound, "Subject '%s' does not have subject-level mode configured", subject)
+		}
+		if !ok {
+			mode = s.state.Mode[""]
+		}
+		return map[string]string{"mode": mode}, nil
+	case "PUT":
+		var req struct {
+			Mode string `json:"mode"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !modes[req.Mode] {
+			return nil, newError(errInvalidMode, "Invalid mode. Valid values are READWRITE, READONLY and IMPORT")
+		}
+		s.state.Mode[subject] = req.Mode
+		if err := s.state.save(s.dir); err != nil {
+			return nil, err
+		}
+		return map[string]string{"mode": req.Mode}, nil
+	case "DELETE":
+		mode, ok := s.state.Mode[subject]
+		if !ok {
+			return nil, newError(errSubjectModeNotFound, "Subject '%s' does not have subject-level mode configured", subject)
+		}
+		if subject == "" {
+			s.state.Mode[""] = defaultMode
+		} else {
+			delete(s.state.Mode, subject)
+		}
+		if err := s.state.save(s.dir); err != nil {
+			return nil, err
+		}
+		return map[string]string{"mode": mode}, nil
+	}
+	return nil, methodNotAllowed()
+}
@@ -0,0 +1,324 @@
+package schema_registry_server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/infobloxopen/schema-registry-helper/schema_registry_helper"
+)
+
+const (
+	userV1 = `syntax = "proto3";
+package test;
+message User {
+  string name = 1;
+}
+`
+	userV2 = `syntax = "proto3";
+package test;
+message User {
+  string name = 1;
+  string email = 2;
+}
+`
+	userBroken = `syntax = "proto3";
+package test;
+message User {
+  int64 name = 1;
+}
+`
+)
+
+func newTestServer(t *testing.T, dir string) (*httptest.Server, *schema_registry_helper.SchemaRegistryClient) {
+	s, err := NewServer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return server, schema_registry_helper.CreateSchemaRegistryClient(server.URL)
+}
+
+func TestRegisterAndFetch(t *testing.T) {
+	_, client := newTestServer(t, t.TempDir())
+
+	first, err := client.CreateSchema("users", `{"type": "object"}`, schema_registry_helper.Json, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID() != 1 || first.Version() != 1 {
+		t.Errorf("got id %d version %d, wanted 1 and 1", first.ID(), first.Version())
+	}
+
+	// The same schema under another subject keeps its ID.
+	other, err := client.CreateSchema("accounts", `{"type": "object"}`, schema_registry_helper.Json, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.ID() != first.ID() {
+		t.Errorf("got id %d, wanted %d", other.ID(), first.ID())
+	}
+
+	second, err := client.CreateSchema("users", `{"type": "string"}`, schema_registry_helper.Json, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID() != 2 || second.Version() != 2 {
+		t.Errorf("got id %d version %d, wanted 2 and 2", second.ID(), second.Version())
+	}
+
+	latest, err := client.GetLatestSchema("users", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Schema() != `{"type": "string"}` {
+		t.Errorf("got %s", latest.Schema())
+	}
+	versions, err := client.GetSchemaVersions("users", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Errorf("got versions %v", versions)
+	}
+	subjects, err := client.GetSubjectsBySchemaID(first.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(subjects, ",") != "accounts-value,users-value" {
+		t.Errorf("got subjects %v", subjects)
+	}
+
+	resp, err := client.CheckSchema("users", `{"type": "object"}`, schema_registry_helper.Json, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Version != 1 || resp.ID != 1 {
+		t.Errorf("got %+v", resp)
+	}
+	_, err = client.CheckSchema("users", `{"type": "null"}`, schema_registry_helper.Json, false)
+	if err == nil || !strings.Contains(err.Error(), schema_registry_helper.ErrNotFound) {
+		t.Errorf("got %v, wanted not found", err)
+	}
+}
+
+func TestExportSchema(t *testing.T) {
+	_, client := newTestServer(t, t.TempDir())
+
+	schema := []byte(`{"type": "object", "properties": {"name": {"type": "string"}}}`)
+	id, err := schema_registry_helper.ExportSchema(schema, "service-User", schema_registry_helper.Json, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := schema_registry_helper.ExportSchema(schema, "service-User", schema_registry_helper.Json, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != id {
+		t.Errorf("exporting twice gave %d and %d", id, again)
+	}
+}
+
+func TestProtobufCompatibility(t *testing.T) {
+	_, client := newTestServer(t, t.TempDir())
+
+	if _, err := client.CreateSchema("users", userV1, schema_registry_helper.Protobuf, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateSchema("users", userV2, schema_registry_helper.Protobuf, false); err != nil {
+		t.Fatal(err)
+	}
+	_, err := client.CreateSchema("users", userBroken, schema_registry_helper.Protobuf, false)
+	if err == nil || !strings.Contains(err.Error(), "409") {
+		t.Errorf("got %v, wanted an incompatibility error", err)
+	}
+	_, err = client.CreateSchema("users", "message {", schema_registry_helper.Protobuf, false)
+	if err == nil || !strings.Contains(err.Error(), "422") {
+		t.Errorf("got %v, wanted an invalid schema error", err)
+	}
+}
+
+func TestReferences(t *testing.T) {
+	_, client := newTestServer(t, t.TempDir())
+
+	common := `syntax = "proto3";
+package common;
+message Name {
+  string value = 1;
+}
+`
+	user := `syntax = "proto3";
+package test;
+import "common.proto";
+message User {
+  common.Name name = 1;
+}
+`
+	if _, err := client.CreateSchema("common", common, schema_registry_helper.Protobuf, false); err != nil {
+		t.Fatal(err)
+	}
+	ref := schema_registry_helper.Reference{Name: "common.proto", Subject: "common-value", Version: 1}
+	created, err := client.CreateSchema("users", user, schema_registry_helper.Protobuf, false, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := client.GetReferencedBy("common", 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != created.ID() {
+		t.Errorf("got %v, wanted [%d]", ids, created.ID())
+	}
+
+	missing := schema_registry_helper.Reference{Name: "common.proto", Subject: "common-value", Version: 5}
+	if _, err := client.CreateSchema("others", user, schema_registry_helper.Protobuf, false, missing); err == nil {
+		t.Error("registered a schema with a missing reference")
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	dir := t.TempDir()
+	_, client := newTestServer(t, dir)
+	created, err := client.CreateSchema("users", `{"type": "object"}`, schema_registry_helper.Json, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, restarted := newTestServer(t, dir)
+	schema, err := restarted.GetSchema(created.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.Schema() != `{"type": "object"}` {
+		t.Errorf("got %s", schema.Schema())
+	}
+	next, err := restarted.CreateSchema("users", `{"type": "string"}`, schema_registry_helper.Json, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.ID() != 2 || next.Version() != 2 {
+		t.Errorf("got id %d version %d after restart", next.ID(), next.Version())
+	}
+}
+
+func TestContexts(t *testing.T) {
+	_, client := newTestServer(t, t.TempDir())
+
+	tenant := client.WithContext("tenant")
+	if _, err := tenant.CreateSchema("users", `{"type": "object"}`, schema_registry_helper.Json, false); err != nil {
+		t.Fatal(err)
+	}
+	contexts, err := client.GetContexts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(contexts, ",") != ".,.tenant" {
+		t.Errorf("got contexts %v", contexts)
+	}
+	if _, err := client.GetLatestSchema("users", false); err == nil {
+		t.Error("subject in a context was visible in the default context")
+	}
+	if _, err := tenant.GetLatestSchema("users", false); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSubjectsByContext(t *testing.T) {
+	server, client := newTestServer(t, t.TempDir())
+
+	tenant := client.WithContext("tenant")
+	for _, c := range []*schema_registry_helper.SchemaRegistryClient{client, tenant} {
+		for _, subject := range []string{"users", "orders"} {
+			if _, err := c.CreateSchema(subject, `{"type": "object"}`, schema_registry_helper.Json, false); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "", want: `["orders-value","users-value"]`},
+		{query: "?subjectPrefix=users", want: `["users-value"]`},
+		{query: "?subjectPrefix=%3A.tenant%3A", want: `[":.tenant:orders-value",":.tenant:users-value"]`},
+		{query: "?subjectPrefix=%3A.tenant%3Au", want: `[":.tenant:users-value"]`},
+		{query: "?subjectPrefix=%3A.other%3A", want: `[]`},
+	}
+	for _, tc := range tests {
+		resp, err := http.Get(server.URL + "/subjects" + tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(string(body)) != tc.want {
+			t.Errorf("GET /subjects%s: got %s, wanted %s", tc.query, body, tc.want)
+		}
+	}
+}
+
+var testRequests = []struct {
+	method string
+	path   string
+	body   string
+	status int
+	want   string
+}{
+	{method: "GET", path: "/config", status: 200, want: `{"compatibilityLevel":"BACKWARD"}`},
+	{method: "GET", path: "/config/users-value", status: 404, want: `"error_code":40408`},
+	{method: "GET", path: "/config/users-value?defaultToGlobal=true", status: 200, want: `BACKWARD`},
+	{method: "PUT", path: "/config/users-value", body: `{"compatibility":"NONE"}`, status: 200, want: `{"compatibility":"NONE"}`},
+	{method: "PUT", path: "/config", body: `{"compatibility":"SIDEWAYS"}`, status: 422, want: `"error_code":42203`},
+	{method: "PUT", path: "/mode", body: `{"mode":"READONLY"}`, status: 200, want: `{"mode":"READONLY"}`},
+	{method: "POST", path: "/subjects/users-value/versions", body: `{"schema":"{}"}`, status: 422, want: `"error_code":42205`},
+	{method: "PUT", path: "/mode", body: `{"mode":"READWRITE"}`, status: 200, want: `{"mode":"READWRITE"}`},
+	{method: "POST", path: "/subjects/users-value/versions", body: `{"schema":"{}"}`, status: 200, want: `{"id":1}`},
+	{method: "GET", path: "/subjects/users-value/versions/latest/schema", status: 200, want: `{}`},
+	{method: "GET", path: "/subjects/users-value/versions/2", status: 404, want: `"error_code":40402`},
+	{method: "POST", path: "/compatibility/subjects/users-value/versions/latest", body: `{"schema":"{}"}`, status: 200, want: `{"is_compatible":true}`},
+	{method: "POST", path: "/subjects/users-value/versions", body: `{"schema":"{\"type\":\"object\"}"}`, status: 200, want: `{"id":2}`},
+	{method: "DELETE", path: "/subjects/users-value/versions/2?permanent=true", status: 404, want: `"error_code":40405`},
+	{method: "DELETE", path: "/subjects/users-value/versions/2", status: 200, want: `2`},
+	{method: "GET", path: "/subjects/users-value/versions/2", status: 404, want: `"error_code":40402`},
+	{method: "DELETE", path: "/subjects/users-value/versions/2?permanent=true", status: 200, want: `2`},
+	{method: "GET", path: "/subjects/users-value/versions/2?deleted=true", status: 404, want: `"error_code":40402`},
+	{method: "DELETE", path: "/subjects/users-value?permanent=true", status: 404, want: `"error_code":40405`},
+	{method: "DELETE", path: "/subjects/users-value", status: 200, want: `[1]`},
+	{method: "GET", path: "/subjects", status: 200, want: `[]`},
+	{method: "GET", path: "/subjects?deleted=true", status: 200, want: `["users-value"]`},
+	{method: "DELETE", path: "/subjects/users-value?permanent=true", status: 200, want: `[1]`},
+	{method: "GET", path: "/subjects/users-value/versions", status: 404, want: `"error_code":40401`},
+	{method: "GET", path: "/schemas/ids/7", status: 404, want: `"error_code":40403`},
+}
+
+func TestRequests(t *testing.T) {
+	server, _ := newTestServer(t, t.TempDir())
+
+	for _, tc := range testRequests {
+		req, err := http.NewRequest(tc.method, server.URL+tc.path, strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := new(strings.Builder)
+		_, err = io.Copy(body, resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tc.status || !strings.Contains(body.String(), tc.want) {
+			t.Errorf("%s %s: got %d %s, wanted %d containing %s",
+				tc.method, tc.path, resp.StatusCode, body, tc.status, tc.want)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package schema_registry_server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"github.com/infobloxopen/schema-registry-helper/schema_registry_helper"
+)
+
+const stateFile = "registry.json"
+
+// state is everything the server knows, persisted as a single JSON file.
+type state struct {
+	NextID   int                       `json:"nextId"`
+	Schemas  map[int]*storedSchema     `json:"schemas"`
+	Subjects map[string]*storedSubject `json:"subjects"`
+	Config   map[string]string         `json:"config"`
+	Mode     map[string]string         `json:"mode"`
+}
+
+type storedSchema struct {
+	Schema     string                             `json:"schema"`
+	SchemaType string                             `json:"schemaType"`
+	References []schema_registry_helper.Reference `json:"references,omitempty"`
+	Metadata   *schema_registry_helper.Metadata   `json:"metadata,omitempty"`
+	RuleSet    *schema_registry_helper.RuleSet    `json:"ruleSet,omitempty"`
+}
+
+type storedSubject struct {
+	Versions []*storedVersion `json:"versions"`
+}
+
+type storedVersion struct {
+	Version int  `json:"version"`
+	ID      int  `json:"id"`
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+func newState() *state {
+	return &state{
+		NextID:   1,
+		Schemas:  make(map[int]*storedSchema),
+		Subjects: make(map[string]*storedSubject),
+		Config:   map[string]string{"": defaultCompatibility},
+		Mode:     map[string]string{"": defaultMode},
+	}
+}
+
+func loadState(dir string) (*state, error) {
+	bs, err := ioutil.ReadFile(filepath.Join(dir, stateFile))
+	if os.IsNotExist(err) {
+		return newState(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	st := newState()
+	if err := json.Unmarshal(bs, st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// save writes the state to a temporary file and renames it into place,
+// so a crash never leaves a partially written registry behind.
+func (st *state) save(dir string) error {
+	bs, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, ".registry-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bs); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, stateFile))
+}
+
+func (s *storedSchema) equal(other *storedSchema) bool {
+	return s.Schema == other.Schema && s.SchemaType == other.SchemaType &&
+		reflect.DeepEqual(nilIfEmpty(s.References), nilIfEmpty(other.References)) &&
+		reflect.DeepEqual(s.Metadata, other.Metadata) && reflect.DeepEqual(s.RuleSet, other.RuleSet)
+}
+
+func nilIfEmpty(references []schema_registry_helper.Reference) []schema_registry_helper.Reference {
+	if len(references) == 0 {
+		return nil
+	}
+	return references
+}
+
+// idFor returns the ID of an identical schema registered under any
+// subject, or assigns the next ID, as the registry does.
+func (st *state) idFor(schema *storedSchema) int {
+	for id, existing := range st.Schemas {
+		if existing.equal(schema) {
+			return id
+		}
+	}
+	id := st.NextID
+	st.NextID++
+	st.Schemas[id] = schema
+	return id
+}
+
+// liveVersions returns the versions of a subject that are not soft deleted.
+func (st *state) liveVersions(subject string) []*storedVersion {
+	sub, ok := st.Subjects[subject]
+	if !ok {
+		return nil
+	}
+	live := make([]*storedVersion, 0, len(sub.Versions))
+	for _, v := range sub.Versions {
+		if !v.Deleted {
+			live = append(live, v)
+		}
+	}
+	return live
+}
+
+func (st *state) findVersion(subject string, version int) *storedVersion {
+	sub, ok := st.Subjects[subject]
+	if !ok {
+		return nil
+	}
+	for _, v := range sub.Versions {
+		if v.Version == version {
+			return v
+		}
+	}
+	return nil
+}
+
+// referencedBy returns the IDs of live schema versions that reference the
+// given subject version.
+func (st *state) referencedBy(subject string, version int) []int {
+	ids := make([]int, 0)
+	seen := make(map[int]bool)
+	for _, name := range st.subjectNames(false) {
+		for _, v := range st.liveVersions(name) {
+			if seen[v.ID] {
+				continue
+			}
+			for _, r := range st.Schemas[v.ID].References {
+				if r.Subject == subject && r.Version == version {
+					ids = append(ids, v.ID)
+					seen[v.ID] = true
+					break
+				}
+			}
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func (st *state) subjectNames(deleted bool) []string {
+	names := make([]string, 0, len(st.Subjects))
+	for name := range st.Subjects {
+		if deleted || len(st.liveVersions(name)) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (st *state) compatibility(subject string) string {
+	if level, ok := st.Config[subject]; ok {
+		return level
+	}
+	return st.Config[""]
+}
+
+func (st *state) mode(subject string) string {
+	if mode, ok := st.Mode[subject]; ok {
+		return mode
+	}
+	return st.Mode[""]
+}
@@ -2,34 +2,224 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"text/template"
 
 	"github.com/Masterminds/sprig"
+	"github.com/infobloxopen/schema-registry-helper/schema_registry_helper"
+	"sigs.k8s.io/yaml"
 )
 
 type CR struct {
-	Name   string
-	LName  string
-	Schema string
-	Group  string
+	Name       string
+	LName      string
+	Schema     string
+	Group      string
+	SchemaType string
+	Namespace  string
+	// Version is the API version of the CR, the CRD's storage version.
+	Version string
+
+	// Extra context for user-supplied templates.
+	FilePath     string // path of the schema file
+	Directory    string // namespace directory containing it
+	NamespaceDir string // namespace directory relative to the input directory
+	RawSchema    string // file content, not indented
+	ContentHash  string // hex SHA-256 of the file content
 }
 
+// CRD configures the generated CustomResourceDefinition. The zero value,
+// apart from Group, gives a bare CRD with a single v1 version.
 type CRD struct {
-	Group string
+	Group string `json:"-"`
+	// Versions are the served API versions, v1 if empty. StorageVersion
+	// is the one stored, the first version if empty.
+	Versions       []string `json:"versions,omitempty"`
+	StorageVersion string   `json:"storageVersion,omitempty"`
+	// Status adds a status subresource with the registered subject, ID,
+	// version and conditions.
+	Status bool `json:"status"`
+	// PrinterColumns adds the subject and version to kubectl get.
+	PrinterColumns bool `json:"printerColumns"`
+	// Required makes spec.name and spec.schema required.
+	Required bool `json:"required"`
+	// OptionalFields adds spec.compatibility, spec.references and
+	// spec.isKey.
+	OptionalFields bool `json:"optionalFields"`
+}
+
+// crdVersion is what Kubernetes accepts as an API version name.
+var crdVersion = regexp.MustCompile(`^v[1-9][0-9]*((alpha|beta)[1-9][0-9]*)?$`)
+
+// withDefaults fills in the v1 version and the storage version.
+func (crd CRD) withDefaults() CRD {
+	if len(crd.Versions) == 0 {
+		crd.Versions = []string{"v1"}
+	}
+	if crd.StorageVersion == "" {
+		crd.StorageVersion = crd.Versions[0]
+	}
+	return crd
+}
+
+func (crd CRD) validate() error {
+	seen := make(map[string]bool)
+	for _, version := range crd.Versions {
+		if !crdVersion.MatchString(version) {
+			return fmt.Errorf("crd: invalid version %q", version)
+		}
+		if seen[version] {
+			return fmt.Errorf("crd: version %v is listed twice", version)
+		}
+		seen[version] = true
+	}
+	if crd.StorageVersion != "" && len(crd.Versions) > 0 && !seen[crd.StorageVersion] {
+		return fmt.Errorf("crd: storage version %v is not one of the versions", crd.StorageVersion)
+	}
+	return nil
+}
+
+// Output targets. The Helm target wraps every file in a guard on
+// .Values.schemaregistry.enabled and defaults the topic namespace to the
+// release namespace. The others emit plain YAML for kubectl, and the
+// Kustomize target adds a kustomization.yaml listing the files.
+const (
+	helmTarget       = "helm"
+	kubernetesTarget = "kubernetes"
+	kustomizeTarget  = "kustomize"
+)
+
+// outputOptions controls which files renderFiles produces.
+type outputOptions struct {
+	Target string
+	// Namespace is set as metadata.namespace of the CRs, and as the
+	// namespace of the kustomization, when not empty.
+	Namespace string
+	MakeCrd   bool
+	SkipGuard bool
+	// Guard is the Helm expression the files are wrapped in; the default
+	// is used when empty.
+	Guard string
+	// CRDTemplate replaces crd_skeleton when not empty.
+	CRDTemplate string
+	// CRD configures the CRD; its Group is set by renderFiles.
+	CRD CRD
+}
+
+const kustomization_skeleton = `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+{{- if .Namespace }}
+namespace: {{ .Namespace }}
+{{- end }}
+resources:
+{{- range .Resources }}
+  - {{ . }}
+{{- end }}
+`
+
+const defaultGuard = ".Values.schemaregistry.enabled"
+
+// config holds every setting of the tool. It can be read from a YAML or
+// JSON file with -config; flags override it.
+type config struct {
+	// Inputs are the directories searched for schemas, each laid out as
+	// -inputschema expects.
+	Inputs         []string `json:"inputs,omitempty"`
+	OutputPath     string   `json:"outputPath,omitempty"`
+	Group          string   `json:"group,omitempty"`
+	MakeCRD        bool     `json:"makeCrd,omitempty"`
+	SkipGuard      bool     `json:"skipGuard,omitempty"`
+	Guard          string   `json:"guard,omitempty"`
+	Target         string   `json:"target,omitempty"`
+	Namespace      string   `json:"namespace,omitempty"`
+	Recursive      bool     `json:"recursive,omitempty"`
+	Separator      string   `json:"separator,omitempty"`
+	MaxDepth       int      `json:"maxDepth,omitempty"`
+	FollowSymlinks bool     `json:"followSymlinks,omitempty"`
+	// Verbose prints why each skipped file or directory was skipped.
+	Verbose bool `json:"verbose,omitempty"`
+	// SkipValidation turns off the checks of validateSchemas.
+	SkipValidation bool `json:"skipValidation,omitempty"`
+	// CRD configures the CRD written with MakeCRD.
+	CRD CRD `json:"crd"`
+	// CRTemplate and CRDTemplate are files with Go templates replacing
+	// cr_skeleton and crd_skeleton.
+	CRTemplate  string `json:"crTemplate,omitempty"`
+	CRDTemplate string `json:"crdTemplate,omitempty"`
+	namingRules
+	Overrides []directoryOverride `json:"overrides,omitempty"`
+
+	crTemplate  string
+	crdTemplate string
+}
+
+// namingRules decide which schema files get CRs and what their topics
+// are called. They can be overridden per directory.
+type namingRules struct {
+	CRNamespace string   `json:"crNamespace,omitempty"`
+	Omit        []string `json:"omit,omitempty"`
+	// NameTemplate is a Go template for the topic name, executed with
+	// nameData and the sprig functions.
+	NameTemplate string `json:"nameTemplate,omitempty"`
+	// Include and Exclude are patterns selecting schema files; with
+	// Include, only matching files are used. See matchPattern.
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// directoryOverride changes the naming rules of the namespace directories
+// whose path, relative to the input directory, matches the glob Path.
+type directoryOverride struct {
+	Path string `json:"path"`
+	// Skip leaves the matching directories out entirely.
+	Skip bool `json:"skip,omitempty"`
+	namingRules
+}
+
+// walkOptions controls how the input schema directory is searched for
+// namespace directories.
+type walkOptions struct {
+	// Recursive treats every directory below the input that contains
+	// schema files as a namespace, named by its path segments joined with
+	// Separator. Otherwise only the top-level subdirectories are used.
+	Recursive bool
+	Separator string
+	// MaxDepth limits how deep Recursive descends; 0 means no limit.
+	MaxDepth int
+	// FollowSymlinks descends into symbolic links to directories.
+	FollowSymlinks bool
+}
+
+// namespaceDir is a directory of schema files and the namespace used in
+// the topic names and output file of its schemas.
+type namespaceDir struct {
+	Name string
+	Path string
+	// RelPath is Path relative to the input directory, with "/" separators.
+	RelPath string
 }
 
-const cr_skeleton = `apiVersion: "{{ .Group }}/v1"
+const cr_skeleton = `apiVersion: "{{ .Group }}/{{ .Version }}"
 kind: Jsonschema
 metadata:
   name: {{ .LName }}
+{{- if .Namespace }}
+  namespace: {{ .Namespace }}
+{{- end }}
 spec:
   name: {{ .Name }}
+{{- if and .SchemaType (ne .SchemaType "JSON") }}
+  schemaType: {{ .SchemaType }}
+{{- end }}
   schema: |
 {{- .Schema | nindent 4 }}
 `
@@ -41,20 +231,118 @@ metadata:
 spec:
   group: {{ .Group}}
   versions:
-    - name: v1
+{{- range .Versions }}
+    - name: {{ . }}
       served: true
-      storage: true
+      storage: {{ eq . $.StorageVersion }}
+{{- if $.Status }}
+      subresources:
+        status: {}
+{{- end }}
+{{- if $.PrinterColumns }}
+      additionalPrinterColumns:
+        - name: Subject
+          type: string
+          jsonPath: .status.subject
+        - name: Version
+          type: integer
+          jsonPath: .status.version
+        - name: Age
+          type: date
+          jsonPath: .metadata.creationTimestamp
+{{- end }}
       schema:
         openAPIV3Schema:
           type: object
           properties:
             spec:
               type: object
+{{- if $.Required }}
+              required:
+                - name
+                - schema
+{{- end }}
               properties:
                 schema:
                   type: string
                 name:
                   type: string
+                schemaType:
+                  type: string
+                  enum:
+                    - JSON
+                    - AVRO
+                    - PROTOBUF
+                  default: JSON
+{{- if $.OptionalFields }}
+                compatibility:
+                  type: string
+                  enum:
+                    - BACKWARD
+                    - BACKWARD_TRANSITIVE
+                    - FORWARD
+                    - FORWARD_TRANSITIVE
+                    - FULL
+                    - FULL_TRANSITIVE
+                    - NONE
+                isKey:
+                  type: boolean
+                  default: false
+                references:
+                  type: array
+                  items:
+                    type: object
+                    required:
+                      - name
+                      - subject
+                      - version
+                    properties:
+                      name:
+                        type: string
+                      subject:
+                        type: string
+                      version:
+                        type: integer
+{{- end }}
+{{- if $.Status }}
+            status:
+              type: object
+              properties:
+                subject:
+                  type: string
+                isKey:
+                  type: boolean
+                id:
+                  type: integer
+                version:
+                  type: integer
+                observedGeneration:
+                  type: integer
+                conditions:
+                  type: array
+                  items:
+                    type: object
+                    required:
+                      - type
+                      - status
+                    properties:
+                      type:
+                        type: string
+                      status:
+                        type: string
+                        enum:
+                          - "True"
+                          - "False"
+                          - Unknown
+                      reason:
+                        type: string
+                      message:
+                        type: string
+                      lastTransitionTime:
+                        type: string
+                        format: date-time
+{{- end }}
+{{- end }}
   scope: Namespaced
   names:
     plural: jsonschemas
@@ -65,97 +353,440 @@ spec:
 `
 
 func main() {
+	configPtr := flag.String("config", "", "A YAML or JSON file with the settings below, several input directories and per-directory overrides. Flags given on the command line override it (optional).")
 	inputSchemaPtr := flag.String("inputschema", "", "The directory containing the schema files. tool will automatically import all schema files within subdirectories (required).")
 	outputPathPtr := flag.String("outputpath", "", "The path to the directory where the result CRs will go (required).")
 	groupPtr := flag.String("group", "", "The string of the group for the created CR and CRD files (example: schemaregistry.infoblox.com) (required).")
 	makeCrdPtr := flag.Bool("makecrd", false, "Boolean option to choose whether to generate a new CRD file (optional; default false)")
+	includePtr := flag.String("include", "", "Comma-separated patterns; only schema files matching one of them get CRs. See the README for the pattern syntax (optional)")
+	excludePtr := flag.String("exclude", "", "Comma-separated patterns; schema files matching one of them get no CRs, e.g. \"*~,README*,type:re:^Test\" (optional)")
+	crdVersionsPtr := flag.String("crdversions", "", "Comma-separated API versions served by the CRD, the first one stored (optional; default v1)")
+	skipValidationPtr := flag.Bool("skipvalidation", false, "Boolean option to skip checking the schema files before creating CRs or pushing them (optional; default false)")
+	verbosePtr := flag.Bool("verbose", false, "Print why each skipped schema file or directory was skipped (optional; default false)")
+	nameTemplatePtr := flag.String("nametemplate", "", "A Go template for topic names, e.g. \"{{ .Package }}.{{ .Type | lower }}.v1\". Defaults to \"{{ .CRNamespace }}-{{ .Namespace }}-{{ .Type }}\" (optional)")
 	omitPtr := flag.String("omit", "", "Option to omit creating CR entries for types starting with the given string(s). Multiple strings should be comma-separated - e.g. \"read,list\" (optional).")
 	crNamespacePtr := flag.String("crnamespace", "", "Option to use a different namespace for the CRs if {{ .Release.Namespace }} is not desired")
 	skipGuardPtr := flag.Bool("skipguard", false, "Boolean option to choose whether to skip the guard condition in the CR and CRD files (optional; default false)")
+	guardPtr := flag.String("guard", defaultGuard, "The Helm expression the CR and CRD files are guarded by (optional)")
+	targetPtr := flag.String("target", helmTarget, "The output target: helm templates, plain kubernetes YAML, or kustomize, which adds a kustomization.yaml. kubernetes and kustomize require -crnamespace (optional; default helm)")
+	namespacePtr := flag.String("namespace", "", "The Kubernetes namespace set on the CRs, and in the kustomization.yaml, for the kubernetes and kustomize targets (optional)")
+	pushPtr := flag.Bool("push", false, "Register the schemas directly with the schema registry instead of writing CRs. Requires -crnamespace; -outputpath and -group are not used (optional; default false)")
+	registryURLPtr := flag.String("registryurl", os.Getenv("SCHEMA_REGISTRY_URL"), "The schema registry URL used by -push. Credentials are read from SCHEMA_REGISTRY_USERNAME and SCHEMA_REGISTRY_PASSWORD (optional; default $SCHEMA_REGISTRY_URL)")
+	dryRunPtr := flag.Bool("dryrun", false, "With -push, only report which schemas are already registered and which would be registered (optional; default false)")
+	recursivePtr := flag.Bool("recursive", false, "Search the input schema directory recursively; nested directory names are joined into the namespace (optional; default false)")
+	separatorPtr := flag.String("separator", "-", "With -recursive, the separator used to join nested directory names (optional; default \"-\")")
+	maxDepthPtr := flag.Int("maxdepth", 0, "With -recursive, the maximum directory depth searched; 0 means no limit (optional; default 0)")
+	checkPtr := flag.Bool("check", false, "Render the CRs in memory and compare them with the files in -outputpath instead of writing them. Prints a unified diff and exits with status 1 if they differ (optional; default false)")
+	crTemplatePtr := flag.String("crtemplate", "", "A file with a Go template used instead of the built-in CR template. It is given the CR fields plus FilePath, Directory, NamespaceDir, RawSchema and ContentHash, and the sprig functions (optional)")
+	crdTemplatePtr := flag.String("crdtemplate", "", "A file with a Go template used instead of the built-in CRD template (optional)")
+	followSymlinksPtr := flag.Bool("followsymlinks", false, "Descend into symbolic links to directories (optional; default false)")
 
 	flag.Parse()
-	if *inputSchemaPtr == "" || *outputPathPtr == "" || *groupPtr == "" {
-		flag.PrintDefaults()
+	cfg := defaultConfig()
+	if *configPtr != "" {
+		var err error
+		cfg, err = loadConfig(*configPtr)
+		if err != nil {
+			fmt.Printf("Error reading the config file: %v\r\n", err)
+			os.Exit(1)
+		}
+	}
+	// Flags given on the command line override the config file.
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "inputschema":
+			cfg.Inputs = []string{*inputSchemaPtr}
+		case "outputpath":
+			cfg.OutputPath = *outputPathPtr
+		case "group":
+			cfg.Group = *groupPtr
+		case "makecrd":
+			cfg.MakeCRD = *makeCrdPtr
+		case "include":
+			cfg.Include = splitPatterns(*includePtr)
+		case "exclude":
+			cfg.Exclude = splitPatterns(*excludePtr)
+		case "verbose":
+			cfg.Verbose = *verbosePtr
+		case "crdversions":
+			cfg.CRD.Versions = splitPatterns(*crdVersionsPtr)
+			cfg.CRD.StorageVersion = ""
+		case "skipvalidation":
+			cfg.SkipValidation = *skipValidationPtr
+		case "nametemplate":
+			cfg.NameTemplate = *nameTemplatePtr
+		case "omit":
+			cfg.Omit = strings.Split(*omitPtr, ",")
+		case "crnamespace":
+			cfg.CRNamespace = *crNamespacePtr
+		case "skipguard":
+			cfg.SkipGuard = *skipGuardPtr
+		case "guard":
+			cfg.Guard = *guardPtr
+		case "target":
+			cfg.Target = *targetPtr
+		case "namespace":
+			cfg.Namespace = *namespacePtr
+		case "recursive":
+			cfg.Recursive = *recursivePtr
+		case "separator":
+			cfg.Separator = *separatorPtr
+		case "maxdepth":
+			cfg.MaxDepth = *maxDepthPtr
+		case "followsymlinks":
+			cfg.FollowSymlinks = *followSymlinksPtr
+		case "crtemplate":
+			cfg.CRTemplate = *crTemplatePtr
+		case "crdtemplate":
+			cfg.CRDTemplate = *crdTemplatePtr
+		}
+	})
+	if err := cfg.validate(); err != nil {
+		fmt.Printf("Invalid settings: %v\r\n", err)
+		os.Exit(1)
+	}
+	if err := cfg.loadTemplates(); err != nil {
+		fmt.Printf("Error reading templates: %v\r\n", err)
 		os.Exit(1)
 	}
-	inputSchema := *inputSchemaPtr
-	outputPath := *outputPathPtr
-	group := *groupPtr
-	omit := strings.Split(*omitPtr, ",")
 
-	fi1, err := os.Stat(inputSchema)
-	if err != nil {
-		fmt.Printf("Error reading the input schema: %v\r\n", err)
+	if *pushPtr {
+		if len(cfg.Inputs) == 0 || cfg.CRNamespace == "" || *registryURLPtr == "" {
+			fmt.Printf("-push requires -inputschema, -crnamespace and -registryurl.\r\n")
+			flag.PrintDefaults()
+			os.Exit(1)
+		}
+		if !cfg.SkipValidation && !validateSchemas(cfg) {
+			os.Exit(1)
+		}
+		client := schema_registry_helper.CreateSchemaRegistryClient(*registryURLPtr)
+		client.SetCredentials(os.Getenv("SCHEMA_REGISTRY_USERNAME"), os.Getenv("SCHEMA_REGISTRY_PASSWORD"))
+		err := pushSchemas(cfg, client, *dryRunPtr)
+		if err != nil {
+			fmt.Printf("Error pushing schemas: %v\r\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(cfg.Inputs) == 0 || cfg.OutputPath == "" || cfg.Group == "" {
+		flag.PrintDefaults()
 		os.Exit(1)
 	}
+	outputPath := cfg.OutputPath
+
 	fi2, err := os.Stat(outputPath)
-	if !fi1.Mode().IsDir() || !fi2.Mode().IsDir() {
+	for _, inputSchema := range cfg.Inputs {
+		fi1, err := os.Stat(inputSchema)
+		if err != nil {
+			fmt.Printf("Error reading the input schema: %v\r\n", err)
+			os.Exit(1)
+		}
+		if !fi1.Mode().IsDir() {
+			fmt.Printf("Input schema and output path must both be directories.\r\n")
+			os.Exit(1)
+		}
+	}
+	if err != nil || !fi2.Mode().IsDir() {
 		fmt.Printf("Input schema and output path must both be directories.\r\n")
 		os.Exit(1)
 	}
 
-	crOutput := createCrOutput(inputSchema, group, *crNamespacePtr, omit)
-	writeFiles(crOutput, outputPath, group, *makeCrdPtr, *skipGuardPtr)
+	if !cfg.SkipValidation && !validateSchemas(cfg) {
+		os.Exit(1)
+	}
+	crOutput := make(map[string]string)
+	resourceNames := make(map[string]string)
+	for _, inputSchema := range cfg.Inputs {
+		for namespace, output := range createCrOutput(inputSchema, cfg, resourceNames) {
+			if crOutput[namespace] != "" && output != "" {
+				output = crOutput[namespace] + "---\n" + output
+			}
+			crOutput[namespace] = output
+		}
+	}
+	files := renderFiles(crOutput, cfg.Group, cfg.outputOptions())
+	if *checkPtr {
+		if !checkFiles(files, outputPath) {
+			fmt.Printf("Generated files in %v are out of date. Run schema_to_cr without -check to update them.\r\n", outputPath)
+			os.Exit(1)
+		}
+		fmt.Printf("Generated files in %v are up to date.\r\n", outputPath)
+		return
+	}
+	writeFiles(files, outputPath)
+}
+
+// defaultConfig returns the settings used when neither a config file nor
+// flags change them.
+func defaultConfig() *config {
+	return &config{
+		Guard:     defaultGuard,
+		Target:    helmTarget,
+		Separator: "-",
+		CRD:       CRD{Versions: []string{"v1"}},
+	}
 }
 
-func parseNamespaces(schemaDirectory string) []string {
-	files, err := ioutil.ReadDir(schemaDirectory)
+// loadConfig reads a YAML or JSON config file. Keys that are not settings
+// are reported as errors rather than ignored, so typos are caught.
+func loadConfig(path string) (*config, error) {
+	bs, err := ioutil.ReadFile(path)
 	if err != nil {
-		fmt.Printf("Error reading input directory: %v", err)
-		os.Exit(1)
+		return nil, err
 	}
+	cfg := defaultConfig()
+	if err := yaml.UnmarshalStrict(bs, cfg); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return cfg, nil
+}
 
-	namespaces := make([]string, 0)
-	for _, f := range files {
-		if f.IsDir() {
-			namespaces = append(namespaces, f.Name())
+func (cfg *config) validate() error {
+	if strings.ContainsAny(cfg.Separator, "/"+string(filepath.Separator)) {
+		return fmt.Errorf("separator %q must not contain a path separator", cfg.Separator)
+	}
+	if cfg.MaxDepth < 0 {
+		return fmt.Errorf("maxDepth must not be negative")
+	}
+	if err := cfg.CRD.validate(); err != nil {
+		return err
+	}
+	switch cfg.Target {
+	case helmTarget:
+		if cfg.Namespace != "" {
+			return fmt.Errorf("namespace cannot be used with the helm target; Helm sets the release namespace")
+		}
+	case kubernetesTarget, kustomizeTarget:
+		if cfg.CRNamespace == "" {
+			return fmt.Errorf("the %v target requires crNamespace, since {{ .Release.Namespace }} is only set by Helm", cfg.Target)
+		}
+	default:
+		return fmt.Errorf("unknown target %q; use helm, kubernetes or kustomize", cfg.Target)
+	}
+	if err := validateRules(cfg.namingRules, "settings"); err != nil {
+		return err
+	}
+	for i, o := range cfg.Overrides {
+		if o.Path == "" {
+			return fmt.Errorf("override %d has no path", i+1)
+		}
+		if _, err := path.Match(o.Path, ""); err != nil {
+			return fmt.Errorf("override %d: invalid path pattern %q", i+1, o.Path)
+		}
+		if err := validateRules(o.namingRules, fmt.Sprintf("override %q", o.Path)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateRules(rules namingRules, where string) error {
+	for _, pattern := range append(append([]string{}, rules.Include...), rules.Exclude...) {
+		if _, err := matchPattern(pattern, "", ""); err != nil {
+			return fmt.Errorf("%v: invalid pattern %q: %v", where, pattern, err)
 		}
 	}
+	if rules.NameTemplate != "" {
+		t, err := parseNameTemplate(rules.NameTemplate)
+		if err == nil {
+			// Unknown fields are only reported when the template runs.
+			err = t.Execute(ioutil.Discard, nameData{})
+		}
+		if err != nil {
+			return fmt.Errorf("%v: invalid name template: %v", where, err)
+		}
+	}
+	return nil
+}
+
+func (cfg *config) walkOptions() walkOptions {
+	return walkOptions{
+		Recursive:      cfg.Recursive,
+		Separator:      cfg.Separator,
+		MaxDepth:       cfg.MaxDepth,
+		FollowSymlinks: cfg.FollowSymlinks,
+	}
+}
+
+func (cfg *config) outputOptions() outputOptions {
+	return outputOptions{
+		Target:      cfg.Target,
+		Namespace:   cfg.Namespace,
+		MakeCrd:     cfg.MakeCRD,
+		SkipGuard:   cfg.SkipGuard,
+		Guard:       cfg.Guard,
+		CRDTemplate: cfg.crdTemplate,
+		CRD:         cfg.CRD,
+	}
+}
+
+// rulesFor returns the naming rules of a namespace directory: the global
+// rules, replaced field by field by every override whose path matches.
+func (cfg *config) rulesFor(namespace namespaceDir) (namingRules, bool) {
+	rules := cfg.namingRules
+	skip := false
+	for _, o := range cfg.Overrides {
+		if matched, _ := path.Match(o.Path, namespace.RelPath); !matched {
+			continue
+		}
+		skip = o.Skip
+		if o.CRNamespace != "" {
+			rules.CRNamespace = o.CRNamespace
+		}
+		if o.Omit != nil {
+			rules.Omit = o.Omit
+		}
+		if o.NameTemplate != "" {
+			rules.NameTemplate = o.NameTemplate
+		}
+		if o.Include != nil {
+			rules.Include = o.Include
+		}
+		if o.Exclude != nil {
+			rules.Exclude = o.Exclude
+		}
+	}
+	return rules, skip
+}
+
+func parseNamespaces(schemaDirectory string, walk walkOptions) []namespaceDir {
+	namespaces := make([]namespaceDir, 0)
+	visited := make(map[string]bool)
+	var visit func(directory string, segments []string)
+	visit = func(directory string, segments []string) {
+		// Symbolic links can form cycles, so each real directory is only
+		// searched once.
+		if real, err := filepath.EvalSymlinks(directory); err == nil {
+			if visited[real] {
+				return
+			}
+			visited[real] = true
+		}
+		files, err := ioutil.ReadDir(directory)
+		if err != nil {
+			fmt.Printf("Error reading input directory: %v", err)
+			os.Exit(1)
+		}
+		hasFiles := false
+		for _, f := range files {
+			path := directory + "/" + f.Name()
+			if !isDir(f, path, walk.FollowSymlinks) {
+				hasFiles = true
+				continue
+			}
+			if len(segments) > 0 && !walk.Recursive {
+				continue
+			}
+			if walk.MaxDepth > 0 && len(segments) >= walk.MaxDepth {
+				continue
+			}
+			visit(path, append(append([]string{}, segments...), f.Name()))
+		}
+		if len(segments) > 0 && (hasFiles || !walk.Recursive) {
+			namespaces = append(namespaces, namespaceDir{
+				Name:    strings.Join(segments, walk.Separator),
+				Path:    directory,
+				RelPath: strings.Join(segments, "/"),
+			})
+		}
+	}
+	visit(schemaDirectory, nil)
+
 	if len(namespaces) == 0 {
 		fmt.Printf("Schema directory contains no subdirectories. No schemas to update.\r\n")
 		os.Exit(1)
 	}
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].Path < namespaces[j].Path })
 	return namespaces
 }
 
-func createCrOutput(inputSchema, group, crNamespace string, omit []string) map[string]string {
+// isDir reports whether f is a directory, or with followSymlinks a
+// symbolic link to one.
+func isDir(f os.FileInfo, path string, followSymlinks bool) bool {
+	if f.IsDir() {
+		return true
+	}
+	if f.Mode()&os.ModeSymlink == 0 || !followSymlinks {
+		return false
+	}
+	target, err := os.Stat(path)
+	return err == nil && target.IsDir()
+}
+
+// schemaFiles lists the schema files of a namespace directory, leaving out
+// subdirectories, which are namespaces of their own.
+func schemaFiles(namespace namespaceDir) ([]os.FileInfo, error) {
+	files, err := ioutil.ReadDir(namespace.Path)
+	if err != nil {
+		return nil, err
+	}
+	schemas := make([]os.FileInfo, 0, len(files))
+	for _, f := range files {
+		if !isDir(f, namespace.Path+"/"+f.Name(), true) {
+			schemas = append(schemas, f)
+		}
+	}
+	return schemas, nil
+}
+
+// createCrOutput renders the CRs for the schemas in inputSchema by
+// namespace. resourceNames maps the metadata.name of every CR created so
+// far to its schema file; a name that is already taken is an error, since
+// one CR would replace the other.
+func createCrOutput(inputSchema string, cfg *config, resourceNames map[string]string) map[string]string {
 	crOutput := make(map[string]string)
-	namespaces := parseNamespaces(inputSchema)
-	for _, n := range namespaces {
-		namespaceDirectory := inputSchema + "/" + n
+	namespaces := parseNamespaces(inputSchema, cfg.walkOptions())
+	for _, namespace := range namespaces {
+		n := namespace.Name
+		namespaceDirectory := namespace.Path
+		rules, skipDirectory := cfg.rulesFor(namespace)
+		if skipDirectory {
+			if cfg.Verbose {
+				fmt.Printf("Skipping directory %v: an override skips it\r\n", namespaceDirectory)
+			}
+			continue
+		}
 		fmt.Printf("Creating CRs for schemas in directory %v...\r\n", namespaceDirectory)
-		files, err := ioutil.ReadDir(namespaceDirectory)
+		files, err := schemaFiles(namespace)
 		if err != nil {
 			fmt.Printf("Error reading input directory %v, skipping...\r\n", namespaceDirectory)
 			break
 		}
 		namespaceOutput := ""
 		for _, f := range files {
-			skip := false
 			filePath := namespaceDirectory + "/" + f.Name()
-			schemaType := strings.TrimSuffix(f.Name(), filepath.Ext(f.Name()))
-			for _, o := range omit {
-				if o == "" {
-					continue
-				}
-				if strings.HasPrefix(strings.ToLower(schemaType), strings.ToLower(o)) {
-					skip = true
-				}
+			if rules.CRNamespace == "" {
+				rules.CRNamespace = "{{ .Release.Namespace }}"
+			}
+			schemaName, skipReason, err := getSchemaName(rules, namespace, f.Name())
+			if err != nil {
+				fmt.Printf("Error naming schema %v: %v\r\n", filePath, err)
+				os.Exit(1)
 			}
-			if skip {
+			if skipReason != "" {
+				if cfg.Verbose {
+					fmt.Printf("Skipping %v: %v\r\n", filePath, skipReason)
+				}
 				continue
 			}
-			if crNamespace == "" {
-				crNamespace = "{{ .Release.Namespace }}"
+			lName, err := resourceName(schemaName, rules.CRNamespace)
+			if err != nil {
+				fmt.Printf("Error naming custom resource for %v: %v\r\n", filePath, err)
+				os.Exit(1)
+			}
+			if other, ok := resourceNames[lName]; ok {
+				fmt.Printf("Error: %v and %v would both create the custom resource %v\r\n", other, filePath, lName)
+				os.Exit(1)
 			}
-			schemaName := crNamespace + "-" + n + "-" + schemaType
+			resourceNames[lName] = filePath
 			if namespaceOutput != "" {
 				namespaceOutput = namespaceOutput + "---\n"
 			}
 			fmt.Printf("Creating custom resource for topic %v...\r\n", schemaName)
-			text, err := strCreateCR(filePath, schemaName, group)
+			text, err := strCreateCR(filePath, namespace, schemaName, lName, cfg)
 			if err != nil {
-				panic(err.Error())
+				fmt.Printf("Error creating custom resource for %v: %v\r\n", filePath, err)
+				os.Exit(1)
 			}
 			namespaceOutput = namespaceOutput + text
 		}
@@ -164,18 +795,405 @@ func createCrOutput(inputSchema, group, crNamespace string, omit []string) map[s
 	return crOutput
 }
 
-func strCreateCR(inputFilePath, schemaName, group string) (string, error) {
+// nameData is what a name template is executed with.
+type nameData struct {
+	CRNamespace string
+	Namespace   string // the namespace name, e.g. domain-service
+	Directory   string // the last element of the namespace directory, e.g. service
+	Path        string // the namespace directory below the input directory, e.g. domain/service
+	Type        string // the file name without its extension
+	FileName    string
+	// Package and GoPackage are the package statement and go_package
+	// option of Protobuf schemas. GoPackageName is the name after the ";"
+	// in go_package, or else its last path element.
+	Package       string
+	GoPackage     string
+	GoPackageName string
+}
+
+var (
+	protoPackage   = regexp.MustCompile(`(?m)^\s*package\s+([\w.]+)\s*;`)
+	protoGoPackage = regexp.MustCompile(`(?m)^\s*option\s+go_package\s*=\s*"([^"]*)"\s*;`)
+
+	// topicName is what Kafka accepts in topic names.
+	topicName = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+	// dns1123Subdomain is what Kubernetes accepts in metadata.name.
+	dns1123Subdomain = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+)
+
+func parseNameTemplate(text string) (*template.Template, error) {
+	return template.New("name").Funcs(sprig.TxtFuncMap()).Option("missingkey=error").Parse(text)
+}
+
+// newNameData collects the values a name template can use for a schema
+// file. The file is only read for Protobuf schemas.
+func newNameData(rules namingRules, namespace namespaceDir, fileName string) (nameData, error) {
+	data := nameData{
+		CRNamespace: rules.CRNamespace,
+		Namespace:   namespace.Name,
+		Directory:   path.Base(namespace.RelPath),
+		Path:        namespace.RelPath,
+		Type:        strings.TrimSuffix(fileName, filepath.Ext(fileName)),
+		FileName:    fileName,
+	}
+	content, err := ioutil.ReadFile(filepath.Join(namespace.Path, fileName))
+	if err != nil {
+		return data, err
+	}
+	if schema_registry_helper.DetectSchemaType(fileName, content) != schema_registry_helper.Protobuf {
+		return data, nil
+	}
+	if m := protoPackage.FindSubmatch(content); m != nil {
+		data.Package = string(m[1])
+	}
+	if m := protoGoPackage.FindSubmatch(content); m != nil {
+		data.GoPackage = string(m[1])
+		data.GoPackageName = path.Base(data.GoPackage)
+		if i := strings.Index(data.GoPackage, ";"); i >= 0 {
+			data.GoPackage, data.GoPackageName = data.GoPackage[:i], data.GoPackage[i+1:]
+		}
+	}
+	return data, nil
+}
+
+// validateName rejects topic names Kafka would refuse. A Helm expression
+// used as the CR namespace is not checked.
+func validateName(name, crNamespace string) error {
+	checked := name
+	if strings.Contains(crNamespace, "{{") {
+		checked = strings.ReplaceAll(checked, crNamespace, "x")
+	}
+	if len(checked) > 249 || !topicName.MatchString(checked) {
+		return fmt.Errorf("%q is not a valid topic name: it must be at most 249 letters, digits, '.', '_' or '-'", name)
+	}
+	return nil
+}
+
+const (
+	// maxResourceName is the longest metadata.name Kubernetes accepts.
+	maxResourceName = 253
+	// maxNamespaceName is the longest a Kubernetes namespace, and so
+	// what {{ .Release.Namespace }} renders to, can be.
+	maxNamespaceName = 63
+)
+
+// resourceName returns the metadata.name of the CR for a topic. It is
+// the topic name in lower case with characters Kubernetes does not allow
+// replaced by "-". Names that would be too long are truncated and end in
+// a hash of the topic name, so they stay unique. A Helm expression used as
+// the CR namespace is kept as it is, and counted as the longest namespace.
+func resourceName(schemaName, crNamespace string) (string, error) {
+	parts := []string{schemaName}
+	expression := ""
+	if strings.Contains(crNamespace, "{{") {
+		expression = crNamespace
+		parts = strings.Split(schemaName, expression)
+	}
+	length := maxNamespaceName * (len(parts) - 1)
+	for i, part := range parts {
+		parts[i] = sanitizeName(part, i == 0, i == len(parts)-1)
+		length += len(parts[i])
+	}
+	if length > maxResourceName {
+		hash := fmt.Sprintf("%x", sha256.Sum256([]byte(schemaName)))[:8]
+		last := parts[len(parts)-1]
+		keep := len(last) - (length - maxResourceName) - len(hash) - 1
+		if keep < 0 {
+			return "", fmt.Errorf("%q is too long for a resource name", schemaName)
+		}
+		last = strings.TrimRight(last[:keep], "-.")
+		if last != "" || len(parts) > 1 {
+			last += "-"
+		}
+		parts[len(parts)-1] = last + hash
+	}
+	name := strings.Join(parts, expression)
+	checked := strings.ReplaceAll(name, expression, "x")
+	if expression == "" {
+		checked = name
+	}
+	if !dns1123Subdomain.MatchString(checked) {
+		return "", fmt.Errorf("cannot make a resource name from %q", schemaName)
+	}
+	return name, nil
+}
+
+// sanitizeName lower-cases s, replaces characters other than letters,
+// digits, "-" and "." by "-", and removes the empty dot-separated labels
+// and the "-" at the start or end of labels that Kubernetes rejects. The
+// start and end of s are only trimmed when trimStart and trimEnd are set,
+// so that the text next to a Helm expression keeps its separators.
+func sanitizeName(s string, trimStart, trimEnd bool) string {
+	mapped := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		}
+		return '-'
+	}, strings.ToLower(s))
+	labels := strings.Split(mapped, ".")
+	kept := make([]string, 0, len(labels))
+	for i, label := range labels {
+		first, last := i == 0, i == len(labels)-1
+		if !first || trimStart {
+			label = strings.TrimLeft(label, "-")
+		}
+		if !last || trimEnd {
+			label = strings.TrimRight(label, "-")
+		}
+		if label == "" && !(first && !trimStart) && !(last && !trimEnd) {
+			continue
+		}
+		kept = append(kept, label)
+	}
+	return strings.Join(kept, ".")
+}
+
+// getSchemaName returns the topic name used for a schema file, or why the
+// file should be skipped: because its type starts with an omitted prefix
+// or it is not selected by the include and exclude patterns.
+func getSchemaName(rules namingRules, namespace namespaceDir, fileName string) (name, skipReason string, err error) {
+	schemaType := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	for _, o := range rules.Omit {
+		if o == "" {
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(schemaType), strings.ToLower(o)) {
+			return "", fmt.Sprintf("its type starts with the omitted prefix %q", o), nil
+		}
+	}
+	if len(rules.Include) > 0 {
+		if _, ok := matchesAny(rules.Include, namespace.RelPath, fileName); !ok {
+			return "", "it matches no include pattern", nil
+		}
+	}
+	if pattern, ok := matchesAny(rules.Exclude, namespace.RelPath, fileName); ok {
+		return "", fmt.Sprintf("it matches the exclude pattern %q", pattern), nil
+	}
+
+	if rules.NameTemplate == "" {
+		name = rules.CRNamespace + "-" + namespace.Name + "-" + schemaType
+	} else if name, err = executeNameTemplate(rules, namespace, fileName); err != nil {
+		return "", "", err
+	}
+	if err := validateName(name, rules.CRNamespace); err != nil {
+		return "", "", err
+	}
+	return name, "", nil
+}
+
+func executeNameTemplate(rules namingRules, namespace namespaceDir, fileName string) (string, error) {
+	t, err := parseNameTemplate(rules.NameTemplate)
+	if err != nil {
+		return "", err
+	}
+	data, err := newNameData(rules, namespace, fileName)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// splitPatterns splits a comma-separated -include or -exclude value.
+func splitPatterns(s string) []string {
+	patterns := []string{}
+	for _, pattern := range strings.Split(s, ",") {
+		if pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// matchesAny returns the first of patterns that matches a schema file.
+func matchesAny(patterns []string, dir, fileName string) (string, bool) {
+	for _, pattern := range patterns {
+		if matched, _ := matchPattern(pattern, dir, fileName); matched {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// patternFields are the parts of a schema file a pattern can select with
+// a prefix, e.g. "ext:.proto" or "type:re:^Test".
+var patternFields = map[string]func(dir, fileName string) string{
+	"path": func(dir, fileName string) string { return path.Join(dir, fileName) },
+	"dir":  func(dir, fileName string) string { return dir },
+	"name": func(dir, fileName string) string { return fileName },
+	"ext":  func(dir, fileName string) string { return filepath.Ext(fileName) },
+	"type": func(dir, fileName string) string { return strings.TrimSuffix(fileName, filepath.Ext(fileName)) },
+}
+
+// matchPattern matches a schema file in the directory dir, relative to the
+// input directory, against an include or exclude pattern. A pattern may
+// start with one of the patternFields and a ":" to choose what it is
+// matched against; without one, patterns containing a "/" are matched
+// against the path and the others against the file name. The rest of the
+// pattern is a glob, or a regular expression if it starts with "re:".
+func matchPattern(pattern, dir, fileName string) (bool, error) {
+	field := "name"
+	if strings.Contains(pattern, "/") {
+		field = "path"
+	}
+	if i := strings.Index(pattern, ":"); i > 0 {
+		if _, ok := patternFields[pattern[:i]]; ok {
+			field, pattern = pattern[:i], pattern[i+1:]
+		}
+	}
+	value := patternFields[field](dir, fileName)
+	if strings.HasPrefix(pattern, "re:") {
+		re, err := regexp.Compile(strings.TrimPrefix(pattern, "re:"))
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(value), nil
+	}
+	return path.Match(pattern, value)
+}
+
+// validateSchemas checks every schema file that would get a CR with
+// ValidateSchema, and prints each problem found as file:line:column. It
+// returns whether all of them are valid. Protobuf imports are looked up in
+// the schema's directory and its input directory.
+func validateSchemas(cfg *config) bool {
+	valid := true
+	for _, inputSchema := range cfg.Inputs {
+		for _, namespace := range parseNamespaces(inputSchema, cfg.walkOptions()) {
+			rules, skipDirectory := cfg.rulesFor(namespace)
+			if skipDirectory {
+				continue
+			}
+			files, err := schemaFiles(namespace)
+			if err != nil {
+				continue
+			}
+			for _, f := range files {
+				// Naming errors are reported when the CRs are created.
+				if _, skipReason, _ := getSchemaName(rules, namespace, f.Name()); skipReason != "" {
+					continue
+				}
+				filePath := namespace.Path + "/" + f.Name()
+				content, err := ioutil.ReadFile(filePath)
+				if err != nil {
+					fmt.Printf("%v: %v\r\n", filePath, err)
+					valid = false
+					continue
+				}
+				schemaType := schema_registry_helper.DetectSchemaType(f.Name(), content)
+				importPaths := []string{namespace.Path, inputSchema}
+				for _, schemaError := range schema_registry_helper.ValidateSchema(schemaType, f.Name(), content, importPaths) {
+					if schemaError.Line == 0 {
+						fmt.Printf("%v: %v\r\n", filePath, schemaError.Message)
+					} else {
+						fmt.Printf("%v:%v:%v: %v\r\n", filePath, schemaError.Line, schemaError.Column, schemaError.Message)
+					}
+					valid = false
+				}
+			}
+		}
+	}
+	if !valid {
+		fmt.Printf("Invalid schemas found; no files were written. Use -skipvalidation to create CRs anyway.\r\n")
+	}
+	return valid
+}
+
+// pushSchemas registers every schema that createCrOutput would create a CR
+// for, under the same topic names, and prints the subject, version and ID
+// of each. With dryRun the registry is only queried.
+func pushSchemas(cfg *config, registry schema_registry_helper.SchemaRegistry, dryRun bool) error {
+	for _, inputSchema := range cfg.Inputs {
+		for _, namespace := range parseNamespaces(inputSchema, cfg.walkOptions()) {
+			if err := pushNamespace(cfg, namespace, registry, dryRun); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func pushNamespace(cfg *config, namespace namespaceDir, registry schema_registry_helper.SchemaRegistry, dryRun bool) error {
+	rules, skipDirectory := cfg.rulesFor(namespace)
+	if skipDirectory {
+		if cfg.Verbose {
+			fmt.Printf("Skipping directory %v: an override skips it\r\n", namespace.Path)
+		}
+		return nil
+	}
+	files, err := schemaFiles(namespace)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		schemaName, skipReason, err := getSchemaName(rules, namespace, f.Name())
+		if err != nil {
+			return err
+		}
+		if skipReason != "" {
+			if cfg.Verbose {
+				fmt.Printf("Skipping %v/%v: %v\r\n", namespace.Path, f.Name(), skipReason)
+			}
+			continue
+		}
+		schemaBytes, err := ioutil.ReadFile(namespace.Path + "/" + f.Name())
+		if err != nil {
+			return err
+		}
+		subject := schemaName + "-value"
+		schemaType := schema_registry_helper.DetectSchemaType(f.Name(), schemaBytes)
+		if dryRun {
+			resp, err := registry.CheckSchema(schemaName, string(schemaBytes), schemaType, false)
+			if err != nil && strings.Contains(err.Error(), schema_registry_helper.ErrNotFound) {
+				fmt.Printf("Would register subject %v\r\n", subject)
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("checking subject %v: %v", subject, err)
+			}
+			fmt.Printf("Subject %v version %v id %v is up to date\r\n", subject, resp.Version, resp.ID)
+			continue
+		}
+		version, err := schema_registry_helper.ExportSchema(schemaBytes, schemaName, schemaType, registry)
+		if err != nil {
+			return fmt.Errorf("registering subject %v: %v", subject, err)
+		}
+		schema, err := registry.GetSchemaByVersion(schemaName, version, false)
+		if err != nil {
+			return fmt.Errorf("reading subject %v version %v: %v", subject, version, err)
+		}
+		fmt.Printf("Subject %v version %v id %v\r\n", subject, version, schema.ID())
+	}
+	return nil
+}
+
+func strCreateCR(inputFilePath string, namespace namespaceDir, schemaName, lName string, cfg *config) (string, error) {
 	inputString, err := ioutil.ReadFile(inputFilePath)
 	if err != nil {
 		fmt.Printf("Error reading input file %v\r\n", inputFilePath)
 		os.Exit(1)
 	}
 	var cr CR
-	cr.LName = strings.ToLower(schemaName)
+	cr.LName = lName
 	cr.Name = schemaName
 	cr.Schema = strings.TrimRight(string(strings.ReplaceAll(string(inputString), "\n", "\n    ")), " ")
-	cr.Group = group
-	return createCR(cr)
+	cr.Group = cfg.Group
+	cr.Namespace = cfg.Namespace
+	cr.Version = cfg.CRD.withDefaults().StorageVersion
+	cr.SchemaType = schema_registry_helper.DetectSchemaType(inputFilePath, inputString).String()
+	cr.FilePath = inputFilePath
+	cr.Directory = namespace.Path
+	cr.NamespaceDir = namespace.RelPath
+	cr.RawSchema = string(inputString)
+	cr.ContentHash = fmt.Sprintf("%x", sha256.Sum256(inputString))
+	if cfg.crTemplate == "" {
+		return createCR(cr)
+	}
+	return executeTemplate(cfg.CRTemplate, cfg.crTemplate, cr)
 }
 
 func createCR(cr CR) (string, error) {
@@ -190,47 +1208,305 @@ func createCR(cr CR) (string, error) {
 	return buf.String(), nil
 }
 
-func writeFiles(crOutput map[string]string, outputPath, group string, makeCrd, skipGuard bool) {
-	for namespace, output := range crOutput {
-		fo1, err := os.Create(outputPath + "/jsonschema-" + namespace + "-cr.yaml")
+// executeTemplate renders a user-supplied template, which has the sprig
+// functions like the built-in ones.
+func executeTemplate(name, text string, data interface{}) (string, error) {
+	t, err := template.New(name).Funcs(sprig.TxtFuncMap()).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// loadTemplates reads the CR and CRD template files named in the config.
+func (cfg *config) loadTemplates() error {
+	for _, tmpl := range []struct {
+		path string
+		text *string
+	}{{cfg.CRTemplate, &cfg.crTemplate}, {cfg.CRDTemplate, &cfg.crdTemplate}} {
+		if tmpl.path == "" {
+			continue
+		}
+		bs, err := ioutil.ReadFile(tmpl.path)
 		if err != nil {
-			fmt.Printf("Error creating jsonschema-%v-cr.yaml file\r\n", namespace)
-			os.Exit(1)
+			return err
 		}
-		if !skipGuard {
-			output = "{{- if .Values.schemaregistry.enabled }}\r\n" + output + "{{- end }}\r\n"
+		if _, err := template.New(tmpl.path).Funcs(sprig.TxtFuncMap()).Parse(string(bs)); err != nil {
+			return err
 		}
-		_, err = fo1.WriteString(output)
-		if err != nil {
-			fmt.Printf("Error writing to jsonschema-%v-cr.yaml file\r\n", namespace)
+		*tmpl.text = string(bs)
+	}
+	return nil
+}
+
+// renderFiles returns the contents of every file writeFiles creates, keyed
+// by file name.
+func renderFiles(crOutput map[string]string, group string, options outputOptions) map[string]string {
+	skipGuard := options.SkipGuard || options.Target != helmTarget
+	guard := options.Guard
+	if guard == "" {
+		guard = defaultGuard
+	}
+	files := make(map[string]string)
+	for namespace, output := range crOutput {
+		if !skipGuard {
+			output = guardTemplate(guard, output)
 		}
+		files["jsonschema-"+namespace+"-cr.yaml"] = output
 	}
-	if !makeCrd {
-		return
+	if options.MakeCrd {
+		crd := options.CRD
+		crd.Group = group
+		files["jsonschema-crd.yaml"] = renderCRD(crd, skipGuard, guard, options.CRDTemplate)
+	}
+	if options.Target == kustomizeTarget {
+		files["kustomization.yaml"] = renderKustomization(files, options.Namespace)
+	}
+	return files
+}
+
+func renderCRD(crd CRD, skipGuard bool, guard, crdTemplate string) string {
+	var s string
+	var err error
+	crd = crd.withDefaults()
+	if crdTemplate == "" {
+		s, err = createCRD(crd)
+	} else {
+		s, err = executeTemplate("crd", crdTemplate, crd)
 	}
-	fo2, err := os.Create(outputPath + "/jsonschema-crd.yaml")
 	if err != nil {
-		fmt.Printf("Error creating crd.yaml file\r\n")
+		fmt.Printf("Error creating the CRD: %v\r\n", err)
 		os.Exit(1)
 	}
+	if !skipGuard {
+		s = guardTemplate(guard, s)
+	}
+	return s
+}
+
+// guardTemplate wraps a Helm template in a condition on guard.
+func guardTemplate(guard, s string) string {
+	return "{{- if " + guard + " }}\r\n" + s + "{{- end }}\r\n"
+}
 
-	var crd CRD
-	crd.Group = group
+// renderKustomization lists the rendered files as the resources of a
+// kustomization.
+func renderKustomization(files map[string]string, namespace string) string {
+	resources := make([]string, 0, len(files))
+	for name := range files {
+		resources = append(resources, name)
+	}
+	sort.Strings(resources)
 
-	s, err := createCRD(crd)
+	t := template.Must(template.New("kustomization").Parse(kustomization_skeleton))
+	var buf bytes.Buffer
+	err := t.Execute(&buf, struct {
+		Namespace string
+		Resources []string
+	}{namespace, resources})
 	if err != nil {
 		panic(err.Error())
 	}
-	if !skipGuard {
-		s = "{{- if .Values.schemaregistry.enabled }}\r\n" + s + "{{- end }}\r\n"
+	return buf.String()
+}
+
+func writeFiles(files map[string]string, outputPath string) {
+	for name, output := range files {
+		err := ioutil.WriteFile(outputPath+"/"+name, []byte(output), 0644)
+		if err != nil {
+			fmt.Printf("Error writing to %v file\r\n", name)
+			os.Exit(1)
+		}
+	}
+}
+
+// checkFiles compares rendered files with those in outputPath and prints a
+// unified diff for each one that is missing or out of date. CR files in
+// outputPath that would not be generated, such as those of a removed
+// namespace, are reported as extra. It reports whether all files were up
+// to date and none were extra.
+func checkFiles(files map[string]string, outputPath string) bool {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	upToDate := true
+	for _, name := range names {
+		path := outputPath + "/" + name
+		existing, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Error reading %v: %v\r\n", path, err)
+			os.Exit(1)
+		}
+		if string(existing) == files[name] {
+			continue
+		}
+		upToDate = false
+		if os.IsNotExist(err) {
+			fmt.Printf("%v is missing\r\n", path)
+		}
+		fmt.Print(unifiedDiff(path, path, string(existing), files[name]))
 	}
-	_, err = fo2.WriteString(s)
+
+	// The CRD and kustomization files may be kept by hand when they are not
+	// generated, so only CR files are reported as extra.
+	existing, err := filepath.Glob(filepath.Join(outputPath, "jsonschema-*-cr.yaml"))
 	if err != nil {
-		fmt.Printf("Error writing to crd.yaml file\r\n")
+		fmt.Printf("Error listing %v: %v\r\n", outputPath, err)
+		os.Exit(1)
+	}
+	for _, path := range existing {
+		if _, ok := files[filepath.Base(path)]; !ok {
+			upToDate = false
+			fmt.Printf("%v is not generated any more and should be deleted\r\n", path)
+		}
+	}
+	return upToDate
+}
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// unifiedDiff returns the changes from a to b in unified diff format, or
+// "" if they are equal.
+func unifiedDiff(aName, bName, a, b string) string {
+	if a == b {
+		return ""
+	}
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", aName, bName)
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			i++
+			continue
+		}
+		// Extend the hunk while the next change is close enough that
+		// their context would overlap.
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(lines) && j <= end+2*diffContext; j++ {
+			if lines[j].op != ' ' {
+				end = j
+			}
+		}
+		stop := end + diffContext + 1
+		if stop > len(lines) {
+			stop = len(lines)
+		}
+
+		aStart, bStart := 1, 1
+		for _, l := range lines[:start] {
+			if l.op != '+' {
+				aStart++
+			}
+			if l.op != '-' {
+				bStart++
+			}
+		}
+		aCount, bCount := 0, 0
+		for _, l := range lines[start:stop] {
+			if l.op != '+' {
+				aCount++
+			}
+			if l.op != '-' {
+				bCount++
+			}
+		}
+		if aCount == 0 {
+			aStart--
+		}
+		if bCount == 0 {
+			bStart--
+		}
+		fmt.Fprintf(&buf, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+		for _, l := range lines[start:stop] {
+			fmt.Fprintf(&buf, "%c%s\n", l.op, l.text)
+		}
+		i = stop
+	}
+	return buf.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines aligns a and b on their longest common subsequence, after
+// setting aside the lines they share at the start and end.
+func diffLines(a, b []string) []diffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	// lcs[i][j] is the length of the common subsequence of midA[i:] and midB[j:].
+	lcs := make([][]int, len(midA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(midB)+1)
+	}
+	for i := len(midA) - 1; i >= 0; i-- {
+		for j := len(midB) - 1; j >= 0; j-- {
+			if midA[i] == midB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := make([]diffLine, 0, len(a)+len(b))
+	for _, l := range a[:prefix] {
+		lines = append(lines, diffLine{' ', l})
+	}
+	i, j := 0, 0
+	for i < len(midA) || j < len(midB) {
+		switch {
+		case i < len(midA) && j < len(midB) && midA[i] == midB[j]:
+			lines = append(lines, diffLine{' ', midA[i]})
+			i++
+			j++
+		case j == len(midB) || (i < len(midA) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', midA[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', midB[j]})
+			j++
+		}
+	}
+	for _, l := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{' ', l})
 	}
+	return lines
 }
 
 func createCRD(input CRD) (string, error) {
+	input = input.withDefaults()
 	t, err := template.New("crd").Parse(crd_skeleton)
 	if err != nil {
 		return "", err
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderFilesTargets(t *testing.T) {
+	crOutput := map[string]string{"pb": "kind: Jsonschema\n"}
+
+	helm := renderFiles(crOutput, "group", outputOptions{Target: helmTarget, MakeCrd: true})
+	if !strings.HasPrefix(helm["jsonschema-pb-cr.yaml"], "{{- if .Values.schemaregistry.enabled }}") {
+		t.Errorf("helm CR is not guarded:\n%s", helm["jsonschema-pb-cr.yaml"])
+	}
+	if _, ok := helm["kustomization.yaml"]; ok {
+		t.Error("helm target wrote a kustomization")
+	}
+
+	plain := renderFiles(crOutput, "group", outputOptions{Target: kubernetesTarget, MakeCrd: true})
+	if plain["jsonschema-pb-cr.yaml"] != "kind: Jsonschema\n" || strings.Contains(plain["jsonschema-crd.yaml"], "{{") {
+		t.Errorf("kubernetes target kept Helm templating:\n%v", plain)
+	}
+
+	kustomize := renderFiles(crOutput, "group", outputOptions{Target: kustomizeTarget, Namespace: "events", MakeCrd: true})
+	want := `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+namespace: events
+resources:
+  - jsonschema-crd.yaml
+  - jsonschema-pb-cr.yaml
+`
+	if kustomize["kustomization.yaml"] != want {
+		t.Errorf("got:\n%s\nwanted:\n%s", kustomize["kustomization.yaml"], want)
+	}
+}
+
+func TestCRNamespace(t *testing.T) {
+	s, err := createCR(CR{Name: "n", LName: "n", Schema: "{}", Group: "group", Namespace: "events", Version: "v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(s, "metadata:\n  name: n\n  namespace: events\nspec:") {
+		t.Errorf("got:\n%s", s)
+	}
+}
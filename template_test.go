@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCustomCRTemplate(t *testing.T) {
+	dir := t.TempDir()
+	schemaDir := filepath.Join(dir, "schemas", "service")
+	if err := os.MkdirAll(schemaDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := []byte(`{"type": "record", "name": "Event", "fields": []}`)
+	schemaPath := filepath.Join(schemaDir, "Event.avsc")
+	if err := ioutil.WriteFile(schemaPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	crTemplate := writeConfig(t, "cr.tmpl", `kind: Schema
+name: {{ .LName }}
+type: {{ .SchemaType | lower }}
+dir: {{ .NamespaceDir }}
+file: {{ base .FilePath }}
+hash: {{ .ContentHash | trunc 12 }}
+raw: {{ .RawSchema | b64enc }}
+`)
+	crdTemplate := writeConfig(t, "crd.tmpl", "group: {{ .Group | upper }}\n")
+
+	cfg := defaultConfig()
+	cfg.Group = "group"
+	cfg.CRTemplate = crTemplate
+	cfg.CRDTemplate = crdTemplate
+	if err := cfg.loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	namespace := namespaceDir{Name: "service", Path: schemaDir, RelPath: "service"}
+	got, err := strCreateCR(schemaPath, namespace, "service-Event", "service-event", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256(content))
+	for _, want := range []string{"name: service-event\n", "type: avro\n", "dir: service\n", "file: Event.avsc\n", "hash: " + hash[:12] + "\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("%q not in\n%s", want, got)
+		}
+	}
+
+	crd := renderCRD(CRD{Group: "group"}, true, "", cfg.crdTemplate)
+	if crd != "group: GROUP\n" {
+		t.Errorf("got CRD %q", crd)
+	}
+}
+
+func TestLoadTemplatesInvalid(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.CRTemplate = writeConfig(t, "cr.tmpl", "{{ .Name ")
+	if err := cfg.loadTemplates(); err == nil {
+		t.Error("expected a parse error")
+	}
+	cfg = defaultConfig()
+	cfg.CRDTemplate = filepath.Join(t.TempDir(), "missing.tmpl")
+	if err := cfg.loadTemplates(); err == nil {
+		t.Error("expected a read error")
+	}
+}
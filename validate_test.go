@@ -0,0 +1,40 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateSchemas(t *testing.T) {
+	dir := writeSchemaTree(t)
+	cfg := defaultConfig()
+	cfg.Inputs = []string{dir}
+	cfg.Recursive = true
+	if !validateSchemas(cfg) {
+		t.Fatal("valid schemas were rejected")
+	}
+
+	for name, content := range map[string]string{
+		"Broken.jsonschema": `{"type": "objekt"}`,
+		"Broken.avsc":       `{"type": "record", "name": "Broken"}`,
+		"Broken.proto":      "syntax = \"proto3\";\nmessage Broken { Missing m = 1; }\n",
+	} {
+		path := filepath.Join(dir, "other", name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if validateSchemas(cfg) {
+			t.Errorf("%v was not rejected", name)
+		}
+		cfg.Exclude = []string{name}
+		if !validateSchemas(cfg) {
+			t.Errorf("excluded %v was checked", name)
+		}
+		cfg.Exclude = nil
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
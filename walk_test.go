@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeSchemaTree(t *testing.T) string {
+	dir := t.TempDir()
+	for _, path := range []string{
+		"domain/Top.jsonschema",
+		"domain/service/v1/Event.jsonschema",
+		"domain/service/v2/Event.jsonschema",
+		"other/Thing.jsonschema",
+	} {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(`{"type": "object"}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A link back up the tree must not be followed forever.
+	if err := os.Symlink(filepath.Join(dir, "domain"), filepath.Join(dir, "other", "loop")); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func namespaceNames(namespaces []namespaceDir) []string {
+	names := make([]string, len(namespaces))
+	for i, n := range namespaces {
+		names[i] = n.Name
+	}
+	return names
+}
+
+var testWalks = []struct {
+	walk walkOptions
+	want []string
+}{
+	{
+		walk: walkOptions{},
+		want: []string{"domain", "other"},
+	},
+	{
+		walk: walkOptions{Recursive: true, Separator: "-"},
+		want: []string{"domain", "domain-service-v1", "domain-service-v2", "other"},
+	},
+	{
+		walk: walkOptions{Recursive: true, Separator: ".", MaxDepth: 2},
+		want: []string{"domain", "other"},
+	},
+	{
+		walk: walkOptions{Recursive: true, Separator: "_", MaxDepth: 3},
+		want: []string{"domain", "domain_service_v1", "domain_service_v2", "other"},
+	},
+	{
+		walk: walkOptions{Recursive: true, Separator: "-", FollowSymlinks: true},
+		want: []string{"domain", "domain-service-v1", "domain-service-v2", "other"},
+	},
+}
+
+func TestParseNamespaces(t *testing.T) {
+	dir := writeSchemaTree(t)
+	for _, tc := range testWalks {
+		got := namespaceNames(parseNamespaces(dir, tc.walk))
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%+v: got %v, wanted %v", tc.walk, got, tc.want)
+		}
+	}
+}
+
+func TestCreateCrOutputRecursive(t *testing.T) {
+	dir := writeSchemaTree(t)
+	cfg := defaultConfig()
+	cfg.Group = "group"
+	cfg.CRNamespace = "ns"
+	cfg.Recursive = true
+	cfg.Separator = "."
+	output := createCrOutput(dir, cfg, map[string]string{})
+	cr, ok := output["domain.service.v1"]
+	if !ok {
+		t.Fatalf("got namespaces %v", output)
+	}
+	if want := "name: ns-domain.service.v1-Event"; !strings.Contains(cr, want) {
+		t.Errorf("got:\n%s\nwanted it to contain %q", cr, want)
+	}
+}